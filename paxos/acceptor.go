@@ -1,95 +1,251 @@
 package paxos
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"sync/atomic"
 )
 
+// ErrUnsupportedMessage is reported for a message of a type the acceptor
+// does not handle.
+var ErrUnsupportedMessage = errors.New("paxos: unsupported message")
+
+// errorBuffer is how many unread errors an Acceptor holds before it drops
+// new ones. Dropped errors are still counted.
+const errorBuffer = 64
+
 // Acceptor
 type Acceptor struct {
 	id       int
-	learners []int
+	learners *membership // who hears about accepted values, per slot
 
-	acceptedMessages map[int]messageData // key: slot
-	promisedMessages map[int]messageData // key: slot
-	node             nodeNetwork
-	done             chan struct{}
+	storage  Storage // promised and accepted proposals, keyed by slot
+	node     nodeNetwork
+	logger   *slog.Logger
+	metrics  *metrics
+	observer Observer
+	errs     chan error
+	rejected atomic.Uint64 // messages that could not be handled
+	done     chan struct{}
 }
 
 func NewAcceptor(id int, node nodeNetwork, learners ...int) *Acceptor {
 	return &Acceptor{
-		id:               id,
-		node:             node,
-		learners:         learners,
-		promisedMessages: make(map[int]messageData),
-		acceptedMessages: make(map[int]messageData),
-		done:             make(chan struct{}),
+		id:       id,
+		node:     node,
+		learners: newMembership(learners),
+		storage:  NewMemoryStorage(),
+		logger:   discardLogger,
+		metrics:  newMetrics(),
+		errs:     make(chan error, errorBuffer),
+		done:     make(chan struct{}),
 	}
 }
 
+// SetLogger makes the acceptor log to l, with its ID attached. A nil l turns
+// logging off, which is the default.
+func (a *Acceptor) SetLogger(l *slog.Logger) {
+	a.logger = orDiscard(l).With("Acceptor ID", a.id)
+}
+
+// Errors returns a channel that receives an error for each message the
+// acceptor rejected as unsupported or malformed. The acceptor carries on
+// serving either way. Errors nobody reads are dropped once the channel's
+// buffer is full; Rejected counts them all.
+func (a *Acceptor) Errors() <-chan error {
+	return a.errs
+}
+
+// Rejected returns how many messages the acceptor has rejected as
+// unsupported or malformed.
+func (a *Acceptor) Rejected() uint64 {
+	return a.rejected.Load()
+}
+
+// reject counts and reports a message the acceptor cannot handle.
+func (a *Acceptor) reject(err error) {
+	a.rejected.Add(1)
+	a.logger.Error("Acceptor rejected message", "Error", err)
+	select {
+	case a.errs <- err:
+	default:
+	}
+}
+
+// SetStorage replaces the acceptor's in-memory state with s. Any promises
+// and accepts already held by s are honoured from then on, which is how a
+// restarted acceptor recovers.
+func (a *Acceptor) SetStorage(s Storage) {
+	a.storage = s
+}
+
+func (a *Acceptor) promised(slot int) messageData {
+	msg, _ := a.storage.Promised(slot)
+	return toInternalMessage(msg)
+}
+
+// globalPromiseSlot is the Storage slot holding the acceptor's Multi-Paxos
+// promise. A Prepare for any slot also promises its ballot for every slot,
+// which is what lets a stable leader skip phase 1 for the slots that follow.
+const globalPromiseSlot = -1
+
+// promisedFor returns the promise binding slot: the slot's own promise or
+// the global one, whichever carries the higher ballot.
+func (a *Acceptor) promisedFor(slot int) messageData {
+	promised := a.promised(slot)
+	if global := a.promised(globalPromiseSlot); promised.getBallot().Less(global.getBallot()) {
+		return global
+	}
+	return promised
+}
+
+func (a *Acceptor) accepted(slot int) messageData {
+	msg, _ := a.storage.Accepted(slot)
+	return toInternalMessage(msg)
+}
+
 func (a *Acceptor) Stop() {
 	close(a.done)
 }
 
 // Receive a proposal message and return if accepted or not
-// Phase 2b: accept unless we have already promised a higher number
+// Phase 2b: accept unless we have already promised a higher ballot
 func (a *Acceptor) receiveProposeMessage(msg messageData) bool {
 	slot := msg.slot
-	promised := a.promisedMessages[slot]
-	if promised.getMessageNumber() > msg.getMessageNumber() {
-		slog.Debug("Not taking proposed message",
-			"Acceptor ID", a.id,
+	promised := a.promisedFor(slot)
+	if msg.getBallot().Less(promised.getBallot()) {
+		a.logger.Debug("Not taking proposed message",
+			"Slot", slot,
+			"Proposal Ballot", msg.getBallot(),
+			"Promised Ballot", promised.getBallot(),
+		)
+		return false
+	}
+	// The slot's own promise is raised by accepting, but a value accepted
+	// before that rule may still outrank it.
+	accepted := a.accepted(slot)
+	if msg.getBallot().Less(accepted.getBallot()) {
+		a.logger.Debug("Already accepted a higher ballot",
+			"Slot", slot,
+			"Proposal Ballot", msg.getBallot(),
+			"Accepted Ballot", accepted.getBallot(),
+		)
+		return false
+	}
+	// A proposer that skipped phase 1 for this slot never saw the value we
+	// accepted here, so it must prepare the slot before we take its value.
+	if !accepted.getBallot().IsZero() && accepted.getBallot().Less(msg.getBallot()) &&
+		a.promised(slot).getBallot() != msg.getBallot() {
+		a.logger.Debug("Proposal needs phase 1 for this slot",
 			"Slot", slot,
-			"Proposal ID", msg.getMessageNumber(),
-			"Promised ID", promised.getMessageNumber(),
+			"Proposal Ballot", msg.getBallot(),
+			"Accepted Ballot", accepted.getBallot(),
 		)
 		return false
 	}
-	a.acceptedMessages[slot] = msg
-	slog.Info("Accepted given proposed message",
-		"Acceptor ID", a.id,
+	// Accepting a ballot also promises it for the slot, so that no lower
+	// ballot, such as a stale steady-state proposal, replaces the value.
+	if a.promised(slot).getBallot().Less(msg.getBallot()) {
+		promise := msg
+		promise.messageCategory = PrepareMessage
+		if err := a.storage.SetPromised(slot, toPublicMessage(promise)); err != nil {
+			a.logger.Error("Could not persist promise",
+				"Slot", slot,
+				"Error", err,
+			)
+			return false
+		}
+	}
+	if err := a.storage.SetAccepted(slot, toPublicMessage(msg)); err != nil {
+		a.logger.Error("Could not persist accepted message",
+			"Slot", slot,
+			"Error", err,
+		)
+		return false
+	}
+	a.logger.Debug("Accepted given proposed message",
 		"Slot", slot,
-		"Proposal ID", msg.getMessageNumber(),
+		"Proposal Ballot", msg.getBallot(),
 	)
+	notify(a.observer, Event{Type: ValueAccepted, Node: a.id, Slot: slot,
+		Ballot: msg.getBallot(), Value: []byte(msg.value)})
 	return true
 }
 
 // Receive message of category Prepared and return an Ack Message
 func (a *Acceptor) receivePreparedMessage(msg messageData) *messageData {
 	slot := msg.slot
-	promised := a.promisedMessages[slot]
-	if promised.getMessageNumber() >= msg.getMessageNumber() {
-		slog.Error("Already accepted a larger proposal value message",
-			"Acceptor ID", a.id,
+	promised := a.promisedFor(slot)
+	if !promised.getBallot().Less(msg.getBallot()) {
+		a.logger.Debug("Already accepted a larger proposal value message",
 			"Slot", slot,
-			"Accepted Proposal ID", promised.getMessageNumber(),
-			"Request Proposal ID", msg.getMessageNumber(),
+			"Accepted Proposal Ballot", promised.getBallot(),
+			"Request Proposal Ballot", msg.getBallot(),
 		)
+		notify(a.observer, Event{Type: PromiseRejected, Node: a.id, Slot: slot,
+			Ballot: msg.getBallot(), Promised: promised.getBallot()})
 		return nil
 	}
 	// Include previously accepted value (if any) so proposer can adopt it (P2c)
-	accepted := a.acceptedMessages[slot]
+	accepted := a.accepted(slot)
 	ackValue := msg.value
-	ackNumber := msg.messageNumber
-	if accepted.getMessageNumber() > 0 {
+	ackBallot := msg.ballot
+	if !accepted.getBallot().IsZero() {
 		ackValue = accepted.value
-		ackNumber = accepted.messageNumber
+		ackBallot = accepted.ballot
 	}
 	ack := messageData{
 		messageSender:    a.id,
 		messageRecipient: msg.messageSender,
-		messageNumber:    ackNumber,
+		ballot:           ackBallot,
+		promised:         msg.ballot,
 		value:            ackValue,
 		messageCategory:  AckMessage, // Promise
 		slot:             slot,
+		highestAccepted:  a.storage.HighestAccepted(),
+	}
+	if err := a.storage.SetPromised(slot, toPublicMessage(msg)); err != nil {
+		a.logger.Error("Could not persist promise",
+			"Slot", slot,
+			"Error", err,
+		)
+		return nil
 	}
-	ack.printMessage("Inside receivePreparedMessage")
-	a.promisedMessages[slot] = msg
+	if err := a.storage.SetPromised(globalPromiseSlot, toPublicMessage(msg)); err != nil {
+		a.logger.Error("Could not persist promise",
+			"Slot", globalPromiseSlot,
+			"Error", err,
+		)
+		return nil
+	}
+	ack.printMessage(a.logger, "Inside receivePreparedMessage")
+	notify(a.observer, Event{Type: PromiseGranted, Node: a.id, Slot: slot, Ballot: msg.getBallot()})
 
 	return &ack
 }
 
+// nack tells the sender of a rejected request which ballot this acceptor has
+// promised for the slot, so the proposer can skip straight past it. A ballot
+// equal to the request's own asks the proposer to prepare the slot first.
+func (a *Acceptor) nack(msg messageData) {
+	promised := a.promisedFor(msg.slot)
+	if promised.getBallot().Less(msg.getBallot()) {
+		// Rejected for another reason, such as a storage failure.
+		return
+	}
+	nack := messageData{
+		messageSender:    a.id,
+		messageRecipient: msg.messageSender,
+		messageCategory:  NackMessage,
+		ballot:           promised.getBallot(),
+		slot:             msg.slot,
+	}
+	nack.printMessage(a.logger, "Sending NACK message")
+	a.metrics.nacksSent.Add(1)
+	a.node.send(nack)
+}
+
 func (a *Acceptor) Accept() {
 	for {
 		select {
@@ -97,42 +253,73 @@ func (a *Acceptor) Accept() {
 			return
 		default:
 		}
-		slog.Info(fmt.Sprintf("Acceptor %d waiting for message", a.id))
+		a.logger.Debug("Acceptor waiting for message")
 		message := a.node.receive()
 		if message == nil {
 			// null message obtained
 			continue
 		}
-		message.printMessage(fmt.Sprintf("Acceptor %d received message", a.id))
-		switch message.messageCategory {
-		case PrepareMessage:
-			ack := a.receivePreparedMessage(*message)
-			if ack == nil {
-				continue
+		a.handle(*message)
+	}
+}
+
+// handle answers one Prepare or Propose message. Anything else is rejected.
+func (a *Acceptor) handle(message messageData) {
+	switch {
+	case message.messageCategory != PrepareMessage && message.messageCategory != ProposeMessage:
+		a.reject(fmt.Errorf("%w: %v from %d", ErrUnsupportedMessage, message.messageCategory, message.messageSender))
+		return
+	case message.slot < 0:
+		a.reject(fmt.Errorf("%w: %v from %d for slot %d", ErrMalformedMessage,
+			message.messageCategory, message.messageSender, message.slot))
+		return
+	}
+	message.printMessage(a.logger, "Acceptor received message")
+	if snap, ok := a.storage.Snapshot(); ok && message.slot >= 0 && message.slot <= snap.Slot {
+		// The slot is decided and its state compacted away, so this
+		// acceptor can no longer vote on it. The sender is behind; the
+		// snapshot brings its learner past the slot.
+		a.node.send(snapshotMessage(a.id, message.messageSender, snap))
+		return
+	}
+	switch message.messageCategory {
+	case PrepareMessage:
+		ack := a.receivePreparedMessage(message)
+		if ack == nil {
+			a.nack(message)
+			return
+		}
+		ack.printMessage(a.logger, "Sending ACK message")
+		a.node.send(*ack)
+	case ProposeMessage:
+		acceptedMessage := a.receiveProposeMessage(message)
+		if acceptedMessage == true {
+			// tell the proposer, so it knows when its value is chosen
+			reply := messageData{
+				messageSender:    a.id,
+				messageRecipient: message.messageSender,
+				messageCategory:  AcceptedMessage,
+				ballot:           message.ballot,
+				value:            message.value,
+				slot:             message.slot,
 			}
-			ack.printMessage("Sending ACK message")
-			a.node.send(*ack)
-			continue
-		case ProposeMessage:
-			acceptedMessage := a.receiveProposeMessage(*message)
-			if acceptedMessage == true {
-				// send to all learners
-				for _, learnerID := range a.learners {
-					sendMessage := messageData{
-						messageSender:    a.id,
-						messageRecipient: learnerID,
-						messageCategory:  AcceptMessage,
-						messageNumber:    message.messageNumber,
-						value:            message.value,
-						slot:             message.slot,
-					}
-					sendMessage.printMessage(fmt.Sprintf("Sending message to learner %d", learnerID))
-					a.node.send(sendMessage)
+			reply.printMessage(a.logger, "Sending ACCEPTED message")
+			a.node.send(reply)
+			// send to all learners
+			for _, learnerID := range a.learners.recipients(message.slot) {
+				sendMessage := messageData{
+					messageSender:    a.id,
+					messageRecipient: learnerID,
+					messageCategory:  AcceptMessage,
+					ballot:           message.ballot,
+					value:            message.value,
+					slot:             message.slot,
 				}
+				sendMessage.printMessage(a.logger, "Sending message to learner")
+				a.node.send(sendMessage)
 			}
-		default:
-			slog.Error(fmt.Sprintf("Sending unsupported message in acceptor %d", a.id))
-			os.Exit(1)
+		} else {
+			a.nack(message)
 		}
 	}
 }
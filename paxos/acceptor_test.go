@@ -1,6 +1,7 @@
 package paxos
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -16,7 +17,7 @@ func TestPromiseTracking(t *testing.T) {
 
 	prepare := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: PrepareMessage,
 		value:           "hello",
 	}
@@ -27,13 +28,13 @@ func TestPromiseTracking(t *testing.T) {
 	}
 
 	// promisedMessage should be updated
-	if a.promisedMessages[0].getMessageNumber() != 10100 {
-		t.Errorf("promisedMessage not updated: got %d, want 10100", a.promisedMessages[0].getMessageNumber())
+	if a.promised(0).getBallot() != (Ballot{1, 100}) {
+		t.Errorf("promisedMessage not updated: got %v, want 1.100", a.promised(0).getBallot())
 	}
 
 	// acceptedMessage should NOT be updated by a prepare
-	if a.acceptedMessages[0].getMessageNumber() != 0 {
-		t.Errorf("acceptedMessage should be untouched after prepare: got %d, want 0", a.acceptedMessages[0].getMessageNumber())
+	if a.accepted(0).getBallot() != (Ballot{0, 0}) {
+		t.Errorf("acceptedMessage should be untouched after prepare: got %v, want 0.0", a.accepted(0).getBallot())
 	}
 }
 
@@ -43,7 +44,7 @@ func TestRejectLowerPrepare(t *testing.T) {
 	// First prepare with higher number
 	high := messageData{
 		messageSender:   100,
-		messageNumber:   20100,
+		ballot:          Ballot{2, 100},
 		messageCategory: PrepareMessage,
 		value:           "hello",
 	}
@@ -52,7 +53,7 @@ func TestRejectLowerPrepare(t *testing.T) {
 	// Second prepare with lower number should return nil
 	low := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: PrepareMessage,
 		value:           "hello",
 	}
@@ -68,7 +69,7 @@ func TestAcceptProposal(t *testing.T) {
 	// Promise for proposal 10100
 	prepare := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: PrepareMessage,
 		value:           "hello",
 	}
@@ -77,7 +78,7 @@ func TestAcceptProposal(t *testing.T) {
 	// Propose with same number — should be accepted
 	propose := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: ProposeMessage,
 		value:           "hello",
 	}
@@ -87,11 +88,11 @@ func TestAcceptProposal(t *testing.T) {
 	}
 
 	// acceptedMessage should now be updated
-	if a.acceptedMessages[0].getMessageNumber() != 10100 {
-		t.Errorf("acceptedMessage not updated after accept: got %d, want 10100", a.acceptedMessages[0].getMessageNumber())
+	if a.accepted(0).getBallot() != (Ballot{1, 100}) {
+		t.Errorf("acceptedMessage not updated after accept: got %v, want 1.100", a.accepted(0).getBallot())
 	}
-	if a.acceptedMessages[0].value != "hello" {
-		t.Errorf("acceptedMessage value wrong: got %q, want %q", a.acceptedMessages[0].value, "hello")
+	if a.accepted(0).value != "hello" {
+		t.Errorf("acceptedMessage value wrong: got %q, want %q", a.accepted(0).value, "hello")
 	}
 }
 
@@ -101,7 +102,7 @@ func TestRejectProposalWithLowerNumber(t *testing.T) {
 	// Promise for higher proposal
 	prepare := messageData{
 		messageSender:   100,
-		messageNumber:   20100,
+		ballot:          Ballot{2, 100},
 		messageCategory: PrepareMessage,
 		value:           "hello",
 	}
@@ -110,7 +111,7 @@ func TestRejectProposalWithLowerNumber(t *testing.T) {
 	// Propose with lower number — should be rejected
 	propose := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: ProposeMessage,
 		value:           "hello",
 	}
@@ -126,7 +127,7 @@ func TestAcceptProposalWithHigherNumber(t *testing.T) {
 	// Promise for proposal 10100
 	prepare := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: PrepareMessage,
 		value:           "hello",
 	}
@@ -135,7 +136,7 @@ func TestAcceptProposalWithHigherNumber(t *testing.T) {
 	// Propose with higher number — should be accepted (no higher promise)
 	propose := messageData{
 		messageSender:   100,
-		messageNumber:   20100,
+		ballot:          Ballot{2, 100},
 		messageCategory: ProposeMessage,
 		value:           "world",
 	}
@@ -151,7 +152,7 @@ func TestPreviouslyAcceptedValueInPromise(t *testing.T) {
 	// First round: prepare and accept a value
 	prepare1 := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: PrepareMessage,
 		value:           "first",
 	}
@@ -159,7 +160,7 @@ func TestPreviouslyAcceptedValueInPromise(t *testing.T) {
 
 	propose1 := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: ProposeMessage,
 		value:           "first",
 	}
@@ -169,7 +170,7 @@ func TestPreviouslyAcceptedValueInPromise(t *testing.T) {
 	// Ack should include the previously accepted value
 	prepare2 := messageData{
 		messageSender:   101,
-		messageNumber:   20101,
+		ballot:          Ballot{2, 101},
 		messageCategory: PrepareMessage,
 		value:           "second",
 	}
@@ -180,8 +181,8 @@ func TestPreviouslyAcceptedValueInPromise(t *testing.T) {
 	if ack.value != "first" {
 		t.Errorf("ack should include previously accepted value: got %q, want %q", ack.value, "first")
 	}
-	if ack.messageNumber != 10100 {
-		t.Errorf("ack should include previously accepted proposal number: got %d, want 10100", ack.messageNumber)
+	if ack.ballot != (Ballot{1, 100}) {
+		t.Errorf("ack should include previously accepted ballot: got %v, want 1.100", ack.ballot)
 	}
 }
 
@@ -191,7 +192,7 @@ func TestNoAcceptedValueInFirstPromise(t *testing.T) {
 	// First prepare ever — no previously accepted value
 	prepare := messageData{
 		messageSender:   100,
-		messageNumber:   10100,
+		ballot:          Ballot{1, 100},
 		messageCategory: PrepareMessage,
 		value:           "hello",
 	}
@@ -203,8 +204,8 @@ func TestNoAcceptedValueInFirstPromise(t *testing.T) {
 	if ack.value != "hello" {
 		t.Errorf("first ack should carry prepare's value: got %q, want %q", ack.value, "hello")
 	}
-	if ack.messageNumber != 10100 {
-		t.Errorf("first ack should carry prepare's number: got %d, want 10100", ack.messageNumber)
+	if ack.ballot != (Ballot{1, 100}) {
+		t.Errorf("first ack should carry prepare's ballot: got %v, want 1.100", ack.ballot)
 	}
 }
 
@@ -227,3 +228,139 @@ func TestAcceptorGracefulShutdown(t *testing.T) {
 		t.Fatal("Acceptor did not shut down within 3 seconds after Stop()")
 	}
 }
+
+func TestAcceptorSendsNackWithPromisedNumber(t *testing.T) {
+	a, env := newTestAcceptor(1)
+	go a.Accept()
+	defer a.Stop()
+
+	a.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{2, 100}, messageCategory: PrepareMessage,
+	})
+	proposer := env.GetNodeNetwork(100)
+
+	requests := []messageData{
+		{messageSender: 100, messageRecipient: 1, ballot: Ballot{1, 100}, messageCategory: PrepareMessage},
+		{messageSender: 100, messageRecipient: 1, ballot: Ballot{1, 100}, messageCategory: ProposeMessage},
+	}
+	for _, request := range requests {
+		proposer.send(request)
+		reply := proposer.receiveWithTimeout(3 * time.Second)
+		if reply == nil {
+			t.Fatalf("no reply to rejected %s", messages[request.messageCategory-1])
+		}
+		if reply.messageCategory != NackMessage {
+			t.Fatalf("reply category = %s, want NackMessage", messages[reply.messageCategory-1])
+		}
+		if reply.ballot != (Ballot{2, 100}) {
+			t.Errorf("NACK ballot = %v, want promised ballot 2.100", reply.ballot)
+		}
+	}
+}
+
+func TestPrepareAlsoPromisesLaterSlots(t *testing.T) {
+	a, _ := newTestAcceptor(1)
+
+	a.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{2, 100}, messageCategory: PrepareMessage, slot: 0,
+	})
+
+	if ack := a.receivePreparedMessage(messageData{
+		messageSender: 101, ballot: Ballot{1, 101}, messageCategory: PrepareMessage, slot: 5,
+	}); ack != nil {
+		t.Error("prepare for a later slot below the promised number should be rejected")
+	}
+	if a.receiveProposeMessage(messageData{
+		messageSender: 101, ballot: Ballot{1, 101}, messageCategory: ProposeMessage, slot: 5,
+	}) {
+		t.Error("proposal for a later slot below the promised number should be rejected")
+	}
+	// The leader holding the promise may propose in later slots without preparing them.
+	if !a.receiveProposeMessage(messageData{
+		messageSender: 100, ballot: Ballot{2, 100}, messageCategory: ProposeMessage, value: "steady", slot: 5,
+	}) {
+		t.Error("leader's proposal for a later slot should be accepted without a new prepare")
+	}
+}
+
+func TestSteadyProposalOverAcceptedValueNeedsPrepare(t *testing.T) {
+	a, _ := newTestAcceptor(1)
+
+	// Slot 3 holds a value accepted from an earlier leader.
+	a.receivePreparedMessage(messageData{messageSender: 100, ballot: Ballot{1, 100}, slot: 3})
+	a.receiveProposeMessage(messageData{messageSender: 100, ballot: Ballot{1, 100}, value: "old", slot: 3})
+
+	// A new leader wins phase 1 at slot 0, which never reported slot 3.
+	a.receivePreparedMessage(messageData{messageSender: 101, ballot: Ballot{2, 101}, slot: 0})
+	if a.receiveProposeMessage(messageData{messageSender: 101, ballot: Ballot{2, 101}, value: "new", slot: 3}) {
+		t.Fatal("steady-state proposal must not overwrite a value the leader never saw")
+	}
+
+	// Once the leader prepares slot 3 itself it learns "old" and may propose.
+	ack := a.receivePreparedMessage(messageData{messageSender: 101, ballot: Ballot{3, 101}, slot: 3})
+	if ack == nil || ack.value != "old" {
+		t.Fatalf("prepare for slot 3 = %+v, want ack reporting %q", ack, "old")
+	}
+	if !a.receiveProposeMessage(messageData{messageSender: 101, ballot: Ballot{3, 101}, value: "old", slot: 3}) {
+		t.Error("proposal after preparing the slot should be accepted")
+	}
+}
+
+func TestStaleProposalCannotReplaceHigherAcceptedBallot(t *testing.T) {
+	a, _ := newTestAcceptor(1)
+
+	// Leader 100 holds the promise for every slot; 101 outbids it in slot 3.
+	a.receivePreparedMessage(messageData{messageSender: 100, ballot: Ballot{1, 100}, slot: 0})
+	if !a.receiveProposeMessage(messageData{messageSender: 101, ballot: Ballot{2, 101}, value: "newer", slot: 3}) {
+		t.Fatal("proposal above the promise should be accepted")
+	}
+
+	// Leader 100's steady-state proposal for slot 3 is now stale.
+	if a.receiveProposeMessage(messageData{messageSender: 100, ballot: Ballot{1, 100}, value: "stale", slot: 3}) {
+		t.Error("proposal below the slot's accepted ballot was accepted")
+	}
+	if got := a.accepted(3); got.getBallot() != (Ballot{2, 101}) || got.value != "newer" {
+		t.Errorf("slot 3 accepted = (%v, %q), want (2.101, %q)", got.getBallot(), got.value, "newer")
+	}
+	if got := a.promised(3).getBallot(); got != (Ballot{2, 101}) {
+		t.Errorf("slot 3 promised = %v, want 2.101 from accepting it", got)
+	}
+}
+
+func TestAcceptorReportsBadMessagesAndKeepsServing(t *testing.T) {
+	a, env := newTestAcceptor(1)
+	go a.Accept()
+	defer a.Stop()
+	proposer := env.GetNodeNetwork(100)
+
+	bad := []struct {
+		msg  messageData
+		want error
+	}{
+		{messageData{messageSender: 100, messageRecipient: 1, messageCategory: HeartbeatMessage}, ErrUnsupportedMessage},
+		{messageData{messageSender: 100, messageRecipient: 1, messageCategory: messageType(99)}, ErrUnsupportedMessage},
+		{messageData{messageSender: 100, messageRecipient: 1, messageCategory: PrepareMessage, ballot: Ballot{1, 100}, slot: -1}, ErrMalformedMessage},
+	}
+	for _, tc := range bad {
+		proposer.send(tc.msg)
+		select {
+		case err := <-a.Errors():
+			if !errors.Is(err, tc.want) {
+				t.Errorf("error for %v = %v, want %v", tc.msg.messageCategory, err, tc.want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no error reported for %v", tc.msg.messageCategory)
+		}
+	}
+	if got := a.Rejected(); got != uint64(len(bad)) {
+		t.Errorf("Rejected() = %d, want %d", got, len(bad))
+	}
+	if _, ok := a.storage.Promised(globalPromiseSlot); ok {
+		t.Error("a prepare for slot -1 overwrote the global promise")
+	}
+
+	proposer.send(messageData{messageSender: 100, messageRecipient: 1, messageCategory: PrepareMessage, ballot: Ballot{1, 100}})
+	if reply := proposer.receiveWithTimeout(3 * time.Second); reply == nil || reply.messageCategory != AckMessage {
+		t.Fatalf("reply to a valid prepare after bad messages = %+v, want an ack", reply)
+	}
+}
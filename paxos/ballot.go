@@ -0,0 +1,42 @@
+package paxos
+
+import "fmt"
+
+// Ballot identifies a proposal. Ballots are ordered by Round and then by
+// NodeID, so proposers with different IDs never issue the same ballot and a
+// proposer outbids any ballot by moving to a higher round. The zero Ballot
+// is lower than every ballot a proposer issues.
+type Ballot struct {
+	Round  uint64
+	NodeID uint64
+}
+
+// Compare returns -1, 0 or +1 depending on whether b is lower than, equal
+// to or higher than other.
+func (b Ballot) Compare(other Ballot) int {
+	switch {
+	case b.Round < other.Round:
+		return -1
+	case b.Round > other.Round:
+		return 1
+	case b.NodeID < other.NodeID:
+		return -1
+	case b.NodeID > other.NodeID:
+		return 1
+	}
+	return 0
+}
+
+// Less reports whether b is lower than other.
+func (b Ballot) Less(other Ballot) bool {
+	return b.Compare(other) < 0
+}
+
+// IsZero reports whether b is the zero Ballot, which no proposer issues.
+func (b Ballot) IsZero() bool {
+	return b == Ballot{}
+}
+
+func (b Ballot) String() string {
+	return fmt.Sprintf("%d.%d", b.Round, b.NodeID)
+}
@@ -0,0 +1,125 @@
+package paxos
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// batchMagic starts every slot value that packs a batch. Nodes that batch
+// frame even a single value, so a value without it was never batched.
+const batchMagic = 0xba
+
+// encodeBatch packs values into one slot value: the magic byte, a count,
+// then each value with a uvarint length prefix.
+func encodeBatch(values []string) string {
+	size := 1 + binary.MaxVarintLen64
+	for _, value := range values {
+		size += binary.MaxVarintLen64 + len(value)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, batchMagic)
+	buf = binary.AppendUvarint(buf, uint64(len(values)))
+	for _, value := range values {
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+	}
+	return string(buf)
+}
+
+// decodeBatch unpacks a value built by encodeBatch. It reports false if
+// value is not a well-formed batch.
+func decodeBatch(value string) ([]string, bool) {
+	if len(value) == 0 || value[0] != batchMagic {
+		return nil, false
+	}
+	d := decoder{buf: []byte(value[1:])}
+	count := d.varuint()
+	if d.err != nil || count > uint64(len(d.buf)) {
+		// Every value takes at least its one-byte length prefix.
+		return nil, false
+	}
+	values := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		values = append(values, string(d.bytes()))
+	}
+	if d.err != nil || len(d.buf) != 0 {
+		return nil, false
+	}
+	return values, true
+}
+
+// unbatch returns the entries held by a decided slot: one per batched value,
+// or the value itself if the slot was not batched.
+func unbatch(slot int, value string) []Entry {
+	values, ok := decodeBatch(value)
+	if !ok {
+		return []Entry{{Slot: slot, Value: []byte(value)}}
+	}
+	entries := make([]Entry, len(values))
+	for i, v := range values {
+		entries[i] = Entry{Slot: slot, Index: i, Value: []byte(v)}
+	}
+	return entries
+}
+
+// newBatch combines proposals into one proposal for a single slot.
+func newBatch(props []proposal) proposal {
+	values := make([]string, len(props))
+	for i, prop := range props {
+		values[i] = prop.value
+	}
+	return proposal{value: encodeBatch(values), batch: props}
+}
+
+// unanswered returns what is left of prop to retry after it lost its slot:
+// the values nobody is waiting on. It reports false if there are none.
+func (prop proposal) unanswered() (proposal, bool) {
+	if prop.batch == nil {
+		return prop, prop.done == nil
+	}
+	var rest []proposal
+	for _, member := range prop.batch {
+		if member.done == nil {
+			rest = append(rest, member)
+		}
+	}
+	if len(rest) == 0 {
+		return proposal{}, false
+	}
+	return newBatch(rest), true
+}
+
+// batcher collects proposals until the batch is old, large or long enough
+// to be proposed in one slot.
+type batcher struct {
+	maxDelay time.Duration
+	maxBytes int
+	maxCount int
+
+	pending  []proposal
+	size     int
+	deadline time.Time // when the oldest pending proposal must go out
+}
+
+// add queues prop and reports whether the batch is now full.
+func (b *batcher) add(prop proposal, now time.Time) bool {
+	if len(b.pending) == 0 {
+		b.deadline = now.Add(b.maxDelay)
+	}
+	b.pending = append(b.pending, prop)
+	b.size += len(prop.value)
+	return (b.maxCount > 0 && len(b.pending) >= b.maxCount) ||
+		(b.maxBytes > 0 && b.size >= b.maxBytes)
+}
+
+// due reports whether a pending batch has waited maxDelay.
+func (b *batcher) due(now time.Time) bool {
+	return len(b.pending) > 0 && !now.Before(b.deadline)
+}
+
+// take empties the batcher and returns the pending proposals as one.
+func (b *batcher) take() proposal {
+	prop := newBatch(b.pending)
+	b.pending, b.size = nil, 0
+	return prop
+}
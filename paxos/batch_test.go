@@ -0,0 +1,100 @@
+package paxos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchRoundTrip(t *testing.T) {
+	values := []string{"alpha", "", "gamma"}
+	decoded, ok := decodeBatch(encodeBatch(values))
+	if !ok {
+		t.Fatal("decodeBatch rejected an encoded batch")
+	}
+	if len(decoded) != len(values) {
+		t.Fatalf("decoded %d values, want %d", len(decoded), len(values))
+	}
+	for i := range values {
+		if decoded[i] != values[i] {
+			t.Errorf("value %d = %q, want %q", i, decoded[i], values[i])
+		}
+	}
+}
+
+func TestUnbatchPlainValue(t *testing.T) {
+	entries := unbatch(4, "plain")
+	if len(entries) != 1 || entries[0].Slot != 4 || string(entries[0].Value) != "plain" {
+		t.Errorf("unbatch of an unbatched value = %+v", entries)
+	}
+	// A value that only looks like a batch is left alone.
+	truncated := encodeBatch([]string{"alpha", "beta"})
+	entries = unbatch(4, truncated[:len(truncated)-1])
+	if len(entries) != 1 {
+		t.Errorf("unbatch of a malformed batch returned %d entries, want 1", len(entries))
+	}
+}
+
+func TestBatcherLimits(t *testing.T) {
+	now := time.Now()
+
+	b := &batcher{maxDelay: time.Second, maxCount: 3}
+	if b.add(proposal{value: "a"}, now) || b.add(proposal{value: "b"}, now) {
+		t.Fatal("batch full before reaching maxCount")
+	}
+	if !b.add(proposal{value: "c"}, now) {
+		t.Error("batch not full at maxCount")
+	}
+
+	b = &batcher{maxDelay: time.Second, maxBytes: 8}
+	if b.add(proposal{value: "1234"}, now) {
+		t.Fatal("batch full before reaching maxBytes")
+	}
+	if !b.add(proposal{value: "5678"}, now) {
+		t.Error("batch not full at maxBytes")
+	}
+
+	b = &batcher{maxDelay: 10 * time.Millisecond}
+	b.add(proposal{value: "a"}, now)
+	if b.due(now) {
+		t.Error("batch due before maxDelay")
+	}
+	if !b.due(now.Add(10 * time.Millisecond)) {
+		t.Error("batch not due after maxDelay")
+	}
+	prop := b.take()
+	if len(prop.batch) != 1 || b.due(now.Add(time.Hour)) {
+		t.Errorf("take left the batcher with %d pending", len(b.pending))
+	}
+}
+
+func TestUnansweredKeepsValuesWithoutWaiters(t *testing.T) {
+	batch := newBatch([]proposal{
+		{value: "fire-and-forget"},
+		{value: "waited-on", done: make(chan outcome, 1)},
+	})
+	retry, ok := batch.unanswered()
+	if !ok || len(retry.batch) != 1 || retry.batch[0].value != "fire-and-forget" {
+		t.Errorf("unanswered = (%+v, %v), want the value nobody waits on", retry, ok)
+	}
+	if _, ok := newBatch([]proposal{{value: "x", done: make(chan outcome, 1)}}).unanswered(); ok {
+		t.Error("a batch whose values all have waiters should not be retried")
+	}
+}
+
+func TestReportSaysWhetherBatchLost(t *testing.T) {
+	first, second := make(chan outcome, 1), make(chan outcome, 1)
+	inst := &instance{
+		slot: 7,
+		prop: newBatch([]proposal{{value: "a", done: first}, {value: "b", done: second}}),
+		// Another proposer's batch won, and its first value is also "a".
+		proposalValue: encodeBatch([]string{"a", "z"}),
+		adopted:       true,
+	}
+	p := NewProposer(1, "", nil, 1)
+	p.report(inst)
+	for _, done := range []chan outcome{first, second} {
+		if out := <-done; out.chosen || out.entry.Slot != 7 {
+			t.Errorf("outcome = %+v, want slot 7 lost", out)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package paxos
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Clock tells a Node the time. Heartbeats, timeouts and backoff are measured
+// against it, which lets a Simulation run a cluster on virtual time.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock, used unless another Clock is injected.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// newRand returns a random source seeded from the global one, used unless a
+// seeded source is injected.
+func newRand() *rand.Rand {
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
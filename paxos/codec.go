@@ -0,0 +1,199 @@
+package paxos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// CodecVersion is the wire format version written by MarshalMessage.
+// UnmarshalMessage also accepts every earlier version.
+const CodecVersion byte = 4
+
+var (
+	ErrUnsupportedVersion = errors.New("paxos: unsupported codec version")
+	ErrUnknownMessageType = errors.New("paxos: unknown message type")
+	ErrChecksumMismatch   = errors.New("paxos: message checksum mismatch")
+	ErrMalformedMessage   = errors.New("paxos: malformed message")
+)
+
+// isCodecError reports whether err says a message could not be decoded.
+func isCodecError(err error) bool {
+	return errors.Is(err, ErrUnsupportedVersion) || errors.Is(err, ErrUnknownMessageType) ||
+		errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrMalformedMessage)
+}
+
+// maxValueSize bounds the value length MarshalMessage encodes and
+// UnmarshalMessage accepts, so a corrupt length prefix cannot trigger a huge
+// allocation and nothing is encoded that cannot be decoded.
+const maxValueSize = 16 << 20
+
+/*
+Wire format, version 4:
+
+	version         1 byte
+	type            1 byte
+	from            varint
+	to              varint
+	ballot round    uvarint
+	ballot node     uvarint
+	promised round  uvarint
+	promised node   uvarint
+	slot            varint
+	highest         varint
+	length          uvarint
+	value           length bytes
+	checksum        4 bytes, big-endian CRC-32 (IEEE) of everything before it
+
+Versions 1 to 3 have no highest accepted slot field. Versions 1 and 2 carry
+each ballot as a single varint proposal number, round*10000 + node ID;
+version 1 has no promised field.
+*/
+
+// legacyMaxNodes is the node ID bound built into version 1 and 2 proposal
+// numbers.
+const legacyMaxNodes = 10000
+
+// MarshalMessage encodes msg in the versioned binary wire format.
+func MarshalMessage(msg Message) ([]byte, error) {
+	if !msg.Type.valid() {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownMessageType, msg.Type)
+	}
+	if len(msg.Value) > maxValueSize {
+		return nil, fmt.Errorf("%w: value of %d bytes exceeds %d", ErrMalformedMessage, len(msg.Value), maxValueSize)
+	}
+	buf := make([]byte, 0, 2+8*binary.MaxVarintLen64+binary.MaxVarintLen32+len(msg.Value)+4)
+	buf = append(buf, CodecVersion, byte(msg.Type))
+	buf = binary.AppendVarint(buf, int64(msg.From))
+	buf = binary.AppendVarint(buf, int64(msg.To))
+	buf = appendBallot(buf, msg.Ballot)
+	buf = appendBallot(buf, msg.Promised)
+	buf = binary.AppendVarint(buf, int64(msg.Slot))
+	buf = binary.AppendVarint(buf, int64(msg.HighestAccepted))
+	buf = binary.AppendUvarint(buf, uint64(len(msg.Value)))
+	buf = append(buf, msg.Value...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf)), nil
+}
+
+// UnmarshalMessage decodes a message produced by MarshalMessage. It never
+// panics on malformed input; instead it returns one of the codec errors.
+func UnmarshalMessage(data []byte) (Message, error) {
+	if len(data) < 2+4 {
+		return Message{}, fmt.Errorf("%w: %d bytes", ErrMalformedMessage, len(data))
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return Message{}, ErrChecksumMismatch
+	}
+	version := body[0]
+	if version < 1 || version > CodecVersion {
+		return Message{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	msg := Message{Type: MessageType(body[1])}
+	if !msg.Type.valid() {
+		return Message{}, fmt.Errorf("%w: %d", ErrUnknownMessageType, body[1])
+	}
+
+	d := decoder{buf: body[2:]}
+	msg.From = d.varint()
+	msg.To = d.varint()
+	if version >= 3 {
+		msg.Ballot = d.ballot()
+		msg.Promised = d.ballot()
+	} else {
+		msg.Ballot = d.legacyBallot()
+		if version == 2 {
+			msg.Promised = d.legacyBallot()
+		}
+	}
+	msg.Slot = d.varint()
+	if version >= 4 {
+		msg.HighestAccepted = d.varint()
+	} else if msg.Type == AckMsg {
+		// Older acceptors do not say which slots they hold values in, so
+		// their promises cannot let the leader skip phase 1 anywhere.
+		msg.HighestAccepted = math.MaxInt
+	}
+	msg.Value = d.bytes()
+	if d.err != nil {
+		return Message{}, d.err
+	}
+	if len(d.buf) != 0 {
+		return Message{}, fmt.Errorf("%w: %d trailing bytes", ErrMalformedMessage, len(d.buf))
+	}
+	return msg, nil
+}
+
+func appendBallot(buf []byte, b Ballot) []byte {
+	buf = binary.AppendUvarint(buf, b.Round)
+	return binary.AppendUvarint(buf, b.NodeID)
+}
+
+// decoder consumes fields from buf, remembering the first error.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) varint() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("%w: bad varint", ErrMalformedMessage)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return int(v)
+}
+
+func (d *decoder) varuint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("%w: bad uvarint", ErrMalformedMessage)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) ballot() Ballot {
+	round := d.varuint()
+	return Ballot{Round: round, NodeID: d.varuint()}
+}
+
+// legacyBallot reads a version 1 or 2 proposal number.
+func (d *decoder) legacyBallot() Ballot {
+	number := d.varint()
+	if number < 0 {
+		if d.err == nil {
+			d.err = fmt.Errorf("%w: negative proposal number", ErrMalformedMessage)
+		}
+		return Ballot{}
+	}
+	return Ballot{Round: uint64(number / legacyMaxNodes), NodeID: uint64(number % legacyMaxNodes)}
+}
+
+func (d *decoder) bytes() []byte {
+	if d.err != nil {
+		return nil
+	}
+	size, n := binary.Uvarint(d.buf)
+	if n <= 0 || size > maxValueSize || size > uint64(len(d.buf)-n) {
+		d.err = fmt.Errorf("%w: bad value length", ErrMalformedMessage)
+		return nil
+	}
+	d.buf = d.buf[n:]
+	if size == 0 {
+		return nil
+	}
+	value := append([]byte(nil), d.buf[:size]...)
+	d.buf = d.buf[size:]
+	return value
+}
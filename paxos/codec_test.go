@@ -0,0 +1,168 @@
+package paxos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	msgs := []Message{
+		{From: 1, To: 2, Type: PrepareMsg, Ballot: Ballot{1, 1}, Slot: 0},
+		{From: 3, To: 1, Type: AckMsg, Ballot: Ballot{2, 3}, Promised: Ballot{3, 1}, Value: []byte("hello"), Slot: 42, HighestAccepted: 57},
+		{From: 3, To: 1, Type: AckMsg, Promised: Ballot{3, 1}, Slot: 42, HighestAccepted: -1},
+		{From: 123456, To: 12, Type: AcceptMsg, Ballot: Ballot{Round: math.MaxUint64, NodeID: 123456}, Value: []byte{0, 1, 2, 255}, Slot: 1 << 40},
+		{From: 2, To: 3, Type: HeartbeatMsg},
+	}
+	for _, want := range msgs {
+		data, err := MarshalMessage(want)
+		if err != nil {
+			t.Fatalf("MarshalMessage(%+v): %v", want, err)
+		}
+		if data[0] != CodecVersion {
+			t.Errorf("version byte = %d, want %d", data[0], CodecVersion)
+		}
+		got, err := UnmarshalMessage(data)
+		if err != nil {
+			t.Fatalf("UnmarshalMessage: %v", err)
+		}
+		if got.From != want.From || got.To != want.To || got.Type != want.Type ||
+			got.Ballot != want.Ballot || got.Promised != want.Promised || got.Slot != want.Slot ||
+			got.HighestAccepted != want.HighestAccepted || !bytes.Equal(got.Value, want.Value) {
+			t.Errorf("round trip: got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestCodecRejectsCorruption(t *testing.T) {
+	data, err := MarshalMessage(Message{From: 1, To: 2, Type: ProposeMsg, Ballot: Ballot{0, 7}, Value: []byte("value")})
+	if err != nil {
+		t.Fatalf("MarshalMessage: %v", err)
+	}
+	for i := range data {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0x40
+		if _, err := UnmarshalMessage(corrupt); err == nil {
+			t.Errorf("flipping byte %d was not detected", i)
+		}
+	}
+}
+
+func TestCodecRejectsTruncation(t *testing.T) {
+	data, err := MarshalMessage(Message{From: 1, To: 2, Type: ProposeMsg, Ballot: Ballot{0, 7}, Value: []byte("value")})
+	if err != nil {
+		t.Fatalf("MarshalMessage: %v", err)
+	}
+	for n := 0; n < len(data); n++ {
+		if _, err := UnmarshalMessage(data[:n]); err == nil {
+			t.Errorf("truncation to %d bytes was not detected", n)
+		}
+	}
+}
+
+func TestCodecValueSizeLimit(t *testing.T) {
+	data, err := MarshalMessage(Message{Type: ProposeMsg, Value: make([]byte, maxValueSize)})
+	if err != nil {
+		t.Fatalf("MarshalMessage with a value of maxValueSize: %v", err)
+	}
+	if got, err := UnmarshalMessage(data); err != nil || len(got.Value) != maxValueSize {
+		t.Errorf("UnmarshalMessage = %d-byte value, %v; want %d bytes", len(got.Value), err, maxValueSize)
+	}
+	if _, err := MarshalMessage(Message{Type: ProposeMsg, Value: make([]byte, maxValueSize+1)}); !errors.Is(err, ErrMalformedMessage) {
+		t.Errorf("MarshalMessage with a value over maxValueSize: got %v, want %v", err, ErrMalformedMessage)
+	}
+}
+
+func TestCodecUnknownMessageType(t *testing.T) {
+	if _, err := MarshalMessage(Message{Type: MessageType(99)}); !errors.Is(err, ErrUnknownMessageType) {
+		t.Errorf("MarshalMessage with unknown type: got %v, want %v", err, ErrUnknownMessageType)
+	}
+
+	// Forge a frame with an unknown type but a valid checksum.
+	data, _ := MarshalMessage(Message{Type: PrepareMsg})
+	data[1] = 99
+	data = resum(data)
+	if _, err := UnmarshalMessage(data); !errors.Is(err, ErrUnknownMessageType) {
+		t.Errorf("UnmarshalMessage with unknown type: got %v, want %v", err, ErrUnknownMessageType)
+	}
+}
+
+func TestCodecUnsupportedVersion(t *testing.T) {
+	data, _ := MarshalMessage(Message{Type: PrepareMsg})
+	data[0] = CodecVersion + 1
+	data = resum(data)
+	if _, err := UnmarshalMessage(data); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("got %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
+
+func TestCodecDecodesVersion1(t *testing.T) {
+	// A version 1 Ack as written before the promised field existed.
+	body := []byte{1, byte(AckMsg)}
+	body = binary.AppendVarint(body, 3)
+	body = binary.AppendVarint(body, 1)
+	body = binary.AppendVarint(body, 20003)
+	body = binary.AppendVarint(body, 42)
+	body = binary.AppendUvarint(body, 2)
+	body = append(body, "hi"...)
+	data := binary.BigEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+
+	got, err := UnmarshalMessage(data)
+	if err != nil {
+		t.Fatalf("UnmarshalMessage(v1): %v", err)
+	}
+	want := Message{From: 3, To: 1, Type: AckMsg, Ballot: Ballot{2, 3}, Value: []byte("hi"), Slot: 42}
+	if got.From != want.From || got.To != want.To || got.Type != want.Type || got.Ballot != want.Ballot ||
+		!got.Promised.IsZero() || got.Slot != want.Slot || !bytes.Equal(got.Value, want.Value) {
+		t.Errorf("v1 decode: got %+v, want %+v", got, want)
+	}
+}
+
+func TestCodecDecodesVersion2(t *testing.T) {
+	// A version 2 Ack, with proposal numbers in place of ballots.
+	body := []byte{2, byte(AckMsg)}
+	body = binary.AppendVarint(body, 3)
+	body = binary.AppendVarint(body, 1)
+	body = binary.AppendVarint(body, 20003)
+	body = binary.AppendVarint(body, 30001)
+	body = binary.AppendVarint(body, 42)
+	body = binary.AppendUvarint(body, 0)
+	data := binary.BigEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+
+	got, err := UnmarshalMessage(data)
+	if err != nil {
+		t.Fatalf("UnmarshalMessage(v2): %v", err)
+	}
+	if got.Ballot != (Ballot{2, 3}) || got.Promised != (Ballot{3, 1}) {
+		t.Errorf("v2 decode: ballot %v promised %v, want 2.3 and 3.1", got.Ballot, got.Promised)
+	}
+}
+
+func TestCodecDecodesVersion3(t *testing.T) {
+	// A version 3 Ack, which does not say where the acceptor holds values.
+	body := []byte{3, byte(AckMsg)}
+	body = binary.AppendVarint(body, 3)
+	body = binary.AppendVarint(body, 1)
+	body = appendBallot(body, Ballot{2, 3})
+	body = appendBallot(body, Ballot{3, 1})
+	body = binary.AppendVarint(body, 42)
+	body = binary.AppendUvarint(body, 0)
+	data := binary.BigEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+
+	got, err := UnmarshalMessage(data)
+	if err != nil {
+		t.Fatalf("UnmarshalMessage(v3): %v", err)
+	}
+	if got.Promised != (Ballot{3, 1}) || got.Slot != 42 || got.HighestAccepted != math.MaxInt {
+		t.Errorf("v3 decode: got %+v, want promised 3.1, slot 42 and every slot possibly accepted", got)
+	}
+}
+
+// resum recomputes the trailing checksum after a test has edited the body.
+func resum(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.BigEndian.AppendUint32(append([]byte(nil), body...), crc32.ChecksumIEEE(body))
+}
@@ -0,0 +1,169 @@
+package paxos
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// reorderHold is how long a message held back for reordering waits for a
+// later message to overtake it before it is sent anyway.
+const reorderHold = 20 * time.Millisecond
+
+// Faults are the network faults a FaultInjector applies to every message.
+// Probabilities are between 0 and 1; the zero value delivers everything.
+type Faults struct {
+	Drop      float64 // probability a message is lost
+	Duplicate float64 // probability a message is delivered twice
+	Reorder   float64 // probability a message is held back behind later ones
+
+	// Every message, and each copy of a duplicated one, is delayed by a
+	// random duration between MinDelay and MaxDelay.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+}
+
+// FaultInjector makes an unreliable network out of reliable Transports, for
+// testing Nodes under adverse conditions. Transports wrapped by the same
+// FaultInjector share its faults, partitions and random source, all of which
+// may be changed while messages are in flight. Faults are applied when a
+// message is sent; with a fixed seed and a fixed order of sends, the same
+// messages are dropped, duplicated, delayed and reordered every run.
+type FaultInjector struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	faults Faults
+	groups map[int]int        // node -> partition group; nil when healed
+	rule   func(Message) bool // drops the messages it returns true for
+}
+
+// NewFaultInjector creates a FaultInjector that delivers everything until
+// told otherwise, drawing its random choices from seed.
+func NewFaultInjector(seed uint64) *FaultInjector {
+	return &FaultInjector{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// SetFaults replaces the faults applied to messages sent from now on.
+func (f *FaultInjector) SetFaults(faults Faults) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = faults
+}
+
+// SetDropRule drops every message rule returns true for, such as all Accepts
+// from one node, on top of the random faults. A nil rule removes it.
+func (f *FaultInjector) SetDropRule(rule func(msg Message) bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rule = rule
+}
+
+// Partition splits the network so that only nodes in the same group can
+// reach each other. Nodes named in no group form one more group together, so
+// Partition([]int{id}) cuts id off from everyone else.
+func (f *FaultInjector) Partition(groups ...[]int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.groups = make(map[int]int)
+	for i, group := range groups {
+		for _, id := range group {
+			f.groups[id] = i + 1
+		}
+	}
+}
+
+// Heal removes any partition.
+func (f *FaultInjector) Heal() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.groups = nil
+}
+
+// Wrap returns a Transport that sends through t, subject to f's faults.
+func (f *FaultInjector) Wrap(t Transport) Transport {
+	return &faultyTransport{Transport: t, faults: f}
+}
+
+// decide draws msg's fate: the delay of each copy to deliver, none if it is
+// lost, and whether to hold it back for reordering.
+func (f *FaultInjector) decide(msg Message) ([]time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.groups != nil && f.groups[msg.From] != f.groups[msg.To] {
+		return nil, false
+	}
+	if f.rule != nil && f.rule(msg) {
+		return nil, false
+	}
+	if f.rng.Float64() < f.faults.Drop {
+		return nil, false
+	}
+	copies := 1
+	if f.rng.Float64() < f.faults.Duplicate {
+		copies = 2
+	}
+	delays := make([]time.Duration, copies)
+	for i := range delays {
+		delays[i] = f.faults.MinDelay
+		if spread := f.faults.MaxDelay - f.faults.MinDelay; spread > 0 {
+			delays[i] += time.Duration(f.rng.Int64N(int64(spread) + 1))
+		}
+	}
+	return delays, f.rng.Float64() < f.faults.Reorder
+}
+
+// faultyTransport is a Transport wrapped by a FaultInjector. Receive passes
+// straight through; Send is where messages go astray.
+type faultyTransport struct {
+	Transport
+	faults *FaultInjector
+
+	mu   sync.Mutex
+	held []Message // held back until a later message has been sent
+}
+
+// Send hands msg to the wrapped Transport, unless it is lost. A lost message
+// is not an error, just as on a real network. Errors from copies sent after
+// a delay are dropped too.
+func (t *faultyTransport) Send(msg Message) error {
+	delays, hold := t.faults.decide(msg)
+	for i, delay := range delays {
+		switch {
+		case hold && i == 0:
+			t.hold(msg)
+		case delay > 0:
+			time.AfterFunc(delay, func() { t.send(msg) })
+		default:
+			if err := t.send(msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hold keeps msg back so the next message sent overtakes it. It is sent
+// after reorderHold if no other message comes along first.
+func (t *faultyTransport) hold(msg Message) {
+	t.mu.Lock()
+	t.held = append(t.held, msg)
+	t.mu.Unlock()
+	time.AfterFunc(reorderHold, t.flush)
+}
+
+// send delivers msg, then whatever was held back behind it.
+func (t *faultyTransport) send(msg Message) error {
+	err := t.Transport.Send(msg)
+	t.flush()
+	return err
+}
+
+func (t *faultyTransport) flush() {
+	t.mu.Lock()
+	held := t.held
+	t.held = nil
+	t.mu.Unlock()
+	for _, msg := range held {
+		t.Transport.Send(msg)
+	}
+}
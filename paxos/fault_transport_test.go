@@ -0,0 +1,151 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// receivedSlots reads messages from tr until none arrives for a while and
+// returns their slots in arrival order.
+func receivedSlots(tr Transport) []int {
+	var slots []int
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		msg, err := tr.Receive(ctx)
+		cancel()
+		if err != nil {
+			return slots
+		}
+		slots = append(slots, msg.Slot)
+	}
+}
+
+func TestFaultInjectorPartition(t *testing.T) {
+	f := NewFaultInjector(1)
+	transports := NewChannelTransportGroup(1, 2, 3)
+	t1, t2 := f.Wrap(transports[1]), f.Wrap(transports[2])
+
+	f.Partition([]int{1})
+	t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 1})
+	t2.Send(Message{From: 2, To: 3, Type: PrepareMsg, Slot: 2})
+	if got := receivedSlots(transports[2]); len(got) != 0 {
+		t.Errorf("node 2 received %v across the partition", got)
+	}
+	if got := receivedSlots(transports[3]); fmt.Sprint(got) != "[2]" {
+		t.Errorf("node 3 received %v, want [2] from its own side", got)
+	}
+
+	f.Heal()
+	t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 3})
+	if got := receivedSlots(transports[2]); fmt.Sprint(got) != "[3]" {
+		t.Errorf("node 2 received %v after healing, want [3]", got)
+	}
+}
+
+func TestFaultInjectorDropDuplicateAndRules(t *testing.T) {
+	f := NewFaultInjector(1)
+	transports := NewChannelTransportGroup(1, 2)
+	t1 := f.Wrap(transports[1])
+
+	f.SetFaults(Faults{Drop: 1})
+	t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 1})
+	f.SetFaults(Faults{Duplicate: 1})
+	t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 2})
+	f.SetFaults(Faults{})
+	f.SetDropRule(func(msg Message) bool { return msg.Type == AcceptMsg })
+	t1.Send(Message{From: 1, To: 2, Type: AcceptMsg, Slot: 3})
+	t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 4})
+
+	if got := receivedSlots(transports[2]); fmt.Sprint(got) != "[2 2 4]" {
+		t.Errorf("received slots %v, want [2 2 4]", got)
+	}
+}
+
+func TestFaultInjectorReordersAndDelays(t *testing.T) {
+	f := NewFaultInjector(1)
+	transports := NewChannelTransportGroup(1, 2)
+	t1 := f.Wrap(transports[1])
+
+	f.SetFaults(Faults{Reorder: 1})
+	t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 1})
+	f.SetFaults(Faults{})
+	t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 2})
+	if got := receivedSlots(transports[2]); fmt.Sprint(got) != "[2 1]" {
+		t.Errorf("received slots %v, want slot 1 overtaken by slot 2", got)
+	}
+
+	f.SetFaults(Faults{MinDelay: 50 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+	start := time.Now()
+	t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 3})
+	if _, err := transports[2].Receive(context.Background()); err != nil || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("delayed message arrived after %v (err %v), want at least 50ms", time.Since(start), err)
+	}
+}
+
+func TestFaultInjectorSeedIsDeterministic(t *testing.T) {
+	run := func() []int {
+		f := NewFaultInjector(42)
+		f.SetFaults(Faults{Drop: 0.3, Duplicate: 0.3})
+		transports := NewChannelTransportGroup(1, 2)
+		t1 := f.Wrap(transports[1])
+		for slot := 0; slot < 100; slot++ {
+			t1.Send(Message{From: 1, To: 2, Type: PrepareMsg, Slot: slot})
+		}
+		return receivedSlots(transports[2])
+	}
+	first, second := run(), run()
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("same seed delivered %v, then %v", first, second)
+	}
+	if len(first) == 100 {
+		t.Error("no message was dropped or duplicated")
+	}
+}
+
+func TestNodeSurvivesFaultyNetwork(t *testing.T) {
+	ids := []int{1, 2, 3}
+	f := NewFaultInjector(7)
+	f.SetFaults(Faults{Drop: 0.05, Duplicate: 0.05, Reorder: 0.05, MaxDelay: 5 * time.Millisecond})
+	transports := NewChannelTransportGroup(ids...)
+	nodes := make(map[int]*Node)
+	for _, id := range ids {
+		var peerIDs []int
+		for _, pid := range ids {
+			if pid != id {
+				peerIDs = append(peerIDs, pid)
+			}
+		}
+		nodes[id] = NewNode(id, peerIDs, f.Wrap(transports[id]))
+		nodes[id].Start(context.Background())
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+	})
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// Cut the leader off for a while; the others must carry on without it.
+	f.Partition([]int{3})
+	for i := 0; i < 5; i++ {
+		if _, err := nodes[2].ProposeAndWait(ctx, []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("ProposeAndWait(v%d) during partition: %v", i, err)
+		}
+	}
+	f.Heal()
+	// Node 3 missed those slots, so its first tries may lose to them.
+	for {
+		_, err := nodes[3].ProposeAndWait(ctx, []byte("healed"))
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrNotChosen) {
+			t.Fatalf("ProposeAndWait after healing: %v", err)
+		}
+	}
+}
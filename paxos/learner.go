@@ -2,13 +2,20 @@ package paxos
 
 import (
 	"log/slog"
+	"slices"
+	"sort"
 )
 
 type Learner struct {
 	id               int
-	numAcceptors     int
+	members          *membership                 // acceptors whose votes count, per slot
 	acceptedMessages map[int]map[int]messageData // slot -> acceptor ID -> messageData
+	storage          Storage                     // decided values, keyed by slot
+	pending          map[int]Entry               // decided slots waiting on an earlier slot
+	nextSlot         int                         // lowest slot not yet delivered
+	peers            []int                       // learners asked for slots this one missed
 	node             nodeNetwork
+	logger           *slog.Logger
 	done             chan struct{}
 }
 
@@ -16,27 +23,182 @@ func NewLearner(id int, node nodeNetwork, acceptorIDList ...int) *Learner {
 	return &Learner{
 		id:               id,
 		node:             node,
-		numAcceptors:     len(acceptorIDList),
+		members:          newMembership(acceptorIDList),
 		acceptedMessages: make(map[int]map[int]messageData),
+		storage:          NewMemoryStorage(),
+		pending:          make(map[int]Entry),
+		logger:           discardLogger,
 		done:             make(chan struct{}),
 	}
 }
 
+// SetLogger makes the learner log to l, with its ID attached. A nil l turns
+// logging off, which is the default.
+func (l *Learner) SetLogger(logger *slog.Logger) {
+	l.logger = orDiscard(logger).With("Learner ID", l.id)
+}
+
+// SetStorage makes the learner record decided values in s.
+func (l *Learner) SetStorage(s Storage) {
+	l.storage = s
+}
+
+// decide records value as chosen for slot. It reports whether this is a new
+// decision, so callers deliver each slot exactly once.
+func (l *Learner) decide(slot int, value string) bool {
+	if slot <= compactedThrough(l.storage) {
+		return false
+	}
+	if _, ok := l.storage.Decided(slot); ok {
+		return false
+	}
+	if err := l.storage.SetDecided(slot, []byte(value)); err != nil {
+		l.logger.Error("Could not persist decided value",
+			"Slot", slot,
+			"Error", err,
+		)
+		return false
+	}
+	return true
+}
+
+// ready takes a newly decided entry and returns the entries that can now be
+// delivered in slot order. Slots decided before this learner started, such as
+// those recovered from storage, are skipped rather than waited for.
+func (l *Learner) ready(entry Entry) []Entry {
+	l.pending[entry.Slot] = entry
+	return l.drain()
+}
+
+// drain returns the pending entries that are next in slot order. Slots
+// covered by a snapshot are skipped.
+func (l *Learner) drain() []Entry {
+	l.nextSlot = max(l.nextSlot, compactedThrough(l.storage)+1)
+	defer func() { l.members.advance(l.nextSlot) }()
+	var entries []Entry
+	for {
+		if next, ok := l.pending[l.nextSlot]; ok {
+			delete(l.pending, l.nextSlot)
+			entries = append(entries, next)
+			l.members.apply(l.nextSlot, string(next.Value))
+		} else if value, ok := l.storage.Decided(l.nextSlot); ok {
+			l.members.apply(l.nextSlot, string(value))
+		} else {
+			return entries
+		}
+		l.nextSlot++
+	}
+}
+
+// votedSlots returns, in order, the slots in [from, to) that have votes but
+// no decision yet.
+func (l *Learner) votedSlots(from, to int) []int {
+	var slots []int
+	for slot := range l.acceptedMessages {
+		if slot >= from && slot < to {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Ints(slots)
+	return slots
+}
+
+// SetPeers configures the other learners that catch-up requests go to.
+func (l *Learner) SetPeers(peers ...int) {
+	l.peers = peers
+}
+
+// catchupLimit bounds how many slots one catch-up request asks for.
+const catchupLimit = 64
+
+// lagging reports whether a later slot is decided while an earlier one is
+// still missing.
+func (l *Learner) lagging() bool {
+	return len(l.pending) > 0
+}
+
+// catchupRequests asks every peer for the values decided from the first
+// slot this learner is missing.
+func (l *Learner) catchupRequests() []messageData {
+	from := max(l.nextSlot, compactedThrough(l.storage)+1)
+	for {
+		if _, ok := l.storage.Decided(from); !ok {
+			break
+		}
+		from++
+	}
+	var messageList []messageData
+	for _, peerID := range l.peers {
+		messageList = append(messageList, messageData{
+			messageSender:    l.id,
+			messageRecipient: peerID,
+			messageCategory:  CatchupRequestMessage,
+			slot:             from,
+		})
+	}
+	return messageList
+}
+
+// serveCatchup answers a catch-up request with one reply per slot this
+// learner has decided, from the requested slot up to catchupLimit slots on.
+// Slots this learner has compacted are answered with its snapshot instead.
+func (l *Learner) serveCatchup(request messageData) []messageData {
+	var messageList []messageData
+	from := request.slot
+	if snap, ok := l.storage.Snapshot(); ok && from <= snap.Slot {
+		messageList = append(messageList, snapshotMessage(l.id, request.messageSender, snap))
+		from = snap.Slot + 1
+	}
+	for slot := from; slot < from+catchupLimit; slot++ {
+		value, ok := l.storage.Decided(slot)
+		if !ok {
+			continue
+		}
+		messageList = append(messageList, messageData{
+			messageSender:    l.id,
+			messageRecipient: request.messageSender,
+			messageCategory:  CatchupReplyMessage,
+			value:            string(value),
+			slot:             slot,
+		})
+	}
+	return messageList
+}
+
+// compact forgets the votes and pending entries for slots up to through,
+// which a snapshot now covers.
+func (l *Learner) compact(through int) {
+	for slot := range l.acceptedMessages {
+		if slot <= through {
+			delete(l.acceptedMessages, slot)
+		}
+	}
+	for slot := range l.pending {
+		if slot <= through {
+			delete(l.pending, slot)
+		}
+	}
+	l.nextSlot = max(l.nextSlot, through+1)
+}
+
 func (l *Learner) Stop() {
 	close(l.done)
 }
 
 func (l *Learner) majority() int {
-	return l.numAcceptors/2 + 1
+	return len(l.members.latest())/2 + 1
 }
 
 func (l *Learner) validateAcceptMessage(acceptedMessage messageData) {
 	slot := acceptedMessage.slot
+	if slot <= compactedThrough(l.storage) {
+		return // already decided and compacted
+	}
 	if l.acceptedMessages[slot] == nil {
 		l.acceptedMessages[slot] = make(map[int]messageData)
 	}
 	current := l.acceptedMessages[slot][acceptedMessage.messageSender]
-	if current.getMessageNumber() < acceptedMessage.getMessageNumber() {
+	if current.getBallot().Less(acceptedMessage.getBallot()) {
 		l.acceptedMessages[slot][acceptedMessage.messageSender] = acceptedMessage
 	}
 }
@@ -46,21 +208,29 @@ func (l *Learner) chosen(slot int) (messageData, bool) {
 	if !exists {
 		return messageData{}, false
 	}
+	members, known := l.members.at(slot)
+	if !known {
+		// The votes are kept until the slot's members are known.
+		return messageData{}, false
+	}
 
-	acceptedMessageCount := make(map[int]int)
-	acceptedMessageMap := make(map[int]messageData)
+	acceptedMessageCount := make(map[Ballot]int)
+	acceptedMessageMap := make(map[Ballot]messageData)
 
-	for _, message := range slotMessages {
-		proposalNumber := message.getMessageNumber()
-		if proposalNumber == 0 {
+	for acceptorID, message := range slotMessages {
+		if _, member := slices.BinarySearch(members, acceptorID); !member {
+			continue
+		}
+		ballot := message.getBallot()
+		if ballot.IsZero() {
 			continue // skip uninitialized entries
 		}
-		acceptedMessageCount[proposalNumber] += 1
-		acceptedMessageMap[proposalNumber] = message
+		acceptedMessageCount[ballot] += 1
+		acceptedMessageMap[ballot] = message
 	}
 
-	for number, message := range acceptedMessageMap {
-		if acceptedMessageCount[number] >= l.majority() {
+	for ballot, message := range acceptedMessageMap {
+		if acceptedMessageCount[ballot] >= len(members)/2+1 {
 			return message, true
 		}
 	}
@@ -106,7 +276,7 @@ func (l *Learner) Learn() string {
 		l.validateAcceptMessage(*msg)
 		learnedMessage, learned := l.chosen(msg.slot)
 		if !learned {
-			slog.Info("Learner hasn't learned anything yet.")
+			l.logger.Debug("Learner hasn't learned anything yet.")
 			continue
 		}
 		return learnedMessage.value
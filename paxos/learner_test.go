@@ -1,6 +1,7 @@
 package paxos
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -39,17 +40,17 @@ func TestLearnerChosenExactMajority(t *testing.T) {
 	node := env.GetNodeNetwork(200)
 	l := NewLearner(200, node, 1, 2, 3)
 
-	proposalNum := 10100
+	ballot := Ballot{1, 100}
 
 	// Simulate accept messages from 2 out of 3 acceptors
 	l.validateAcceptMessage(messageData{
 		messageSender: 1,
-		messageNumber: proposalNum,
+		ballot:        ballot,
 		value:         "hello",
 	})
 	l.validateAcceptMessage(messageData{
 		messageSender: 2,
-		messageNumber: proposalNum,
+		ballot:        ballot,
 		value:         "hello",
 	})
 
@@ -65,32 +66,32 @@ func TestLearnerChosenExactMajority(t *testing.T) {
 func TestLearnerChosenNoMajority(t *testing.T) {
 	// Use 5 acceptors so that 1 real accept + 4 zero-value entries
 	// can't form a majority (majority=3, zero-value count=4 which hits
-	// majority — so use different non-zero proposal numbers to avoid
+	// majority — so use different non-zero ballots to avoid
 	// the zero-value false majority).
 	env := NewPaxosEnvironment(1, 2, 3, 200)
 	node := env.GetNodeNetwork(200)
 	l := NewLearner(200, node, 1, 2, 3)
 
-	// Give each acceptor a different proposal number — no majority
+	// Give each acceptor a different ballot — no majority
 	l.validateAcceptMessage(messageData{
 		messageSender: 1,
-		messageNumber: 10100,
+		ballot:        Ballot{1, 100},
 		value:         "hello",
 	})
 	l.validateAcceptMessage(messageData{
 		messageSender: 2,
-		messageNumber: 20200,
+		ballot:        Ballot{2, 200},
 		value:         "world",
 	})
 	l.validateAcceptMessage(messageData{
 		messageSender: 3,
-		messageNumber: 30300,
+		ballot:        Ballot{3, 300},
 		value:         "paxos",
 	})
 
 	_, chosen := l.chosen(0)
 	if chosen {
-		t.Error("chosen() should return false when all acceptors have different proposal numbers")
+		t.Error("chosen() should return false when all acceptors have different ballots")
 	}
 }
 
@@ -99,22 +100,22 @@ func TestChosenPerSlot(t *testing.T) {
 	node := env.GetNodeNetwork(200)
 	l := NewLearner(200, node, 1, 2, 3)
 
-	proposalNum := 10100
+	ballot := Ballot{1, 100}
 
 	// Slot 0: "alpha" accepted by acceptors 1 and 2 (majority)
 	l.validateAcceptMessage(messageData{
-		messageSender: 1, messageNumber: proposalNum, value: "alpha", slot: 0,
+		messageSender: 1, ballot: ballot, value: "alpha", slot: 0,
 	})
 	l.validateAcceptMessage(messageData{
-		messageSender: 2, messageNumber: proposalNum, value: "alpha", slot: 0,
+		messageSender: 2, ballot: ballot, value: "alpha", slot: 0,
 	})
 
 	// Slot 1: "beta" accepted by acceptors 2 and 3 (majority)
 	l.validateAcceptMessage(messageData{
-		messageSender: 2, messageNumber: proposalNum, value: "beta", slot: 1,
+		messageSender: 2, ballot: ballot, value: "beta", slot: 1,
 	})
 	l.validateAcceptMessage(messageData{
-		messageSender: 3, messageNumber: proposalNum, value: "beta", slot: 1,
+		messageSender: 3, ballot: ballot, value: "beta", slot: 1,
 	})
 
 	msg0, chosen0 := l.chosen(0)
@@ -149,3 +150,102 @@ func TestLearnerGracefulShutdown(t *testing.T) {
 		t.Fatal("Learner did not shut down within 3 seconds after Stop()")
 	}
 }
+
+func TestLearnerReadyDeliversInSlotOrder(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 200)
+	l := NewLearner(200, env.GetNodeNetwork(200), 1, 2, 3)
+
+	if got := l.ready(Entry{Slot: 1, Value: []byte("beta")}); len(got) != 0 {
+		t.Errorf("slot 1 delivered before slot 0: %v", got)
+	}
+	if got := l.ready(Entry{Slot: 2, Value: []byte("gamma")}); len(got) != 0 {
+		t.Errorf("slot 2 delivered before slot 0: %v", got)
+	}
+	got := l.ready(Entry{Slot: 0, Value: []byte("alpha")})
+	if len(got) != 3 {
+		t.Fatalf("delivered %d entries once slot 0 was decided, want 3", len(got))
+	}
+	for i, entry := range got {
+		if entry.Slot != i {
+			t.Errorf("entry %d has slot %d", i, entry.Slot)
+		}
+	}
+}
+
+func TestLearnerReadySkipsRecoveredSlots(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 200)
+	l := NewLearner(200, env.GetNodeNetwork(200), 1, 2, 3)
+	// Slot 0 was decided and delivered before a restart.
+	l.storage.SetDecided(0, []byte("alpha"))
+
+	got := l.ready(Entry{Slot: 1, Value: []byte("beta")})
+	if len(got) != 1 || got[0].Slot != 1 {
+		t.Errorf("ready = %v, want slot 1 alone", got)
+	}
+}
+
+func TestLearnerServesCatchup(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 200)
+	l := NewLearner(200, env.GetNodeNetwork(200), 1, 2, 3)
+	for _, slot := range []int{0, 1, 3} {
+		l.storage.SetDecided(slot, []byte(fmt.Sprintf("v%d", slot)))
+	}
+
+	replies := l.serveCatchup(messageData{messageSender: 201, messageCategory: CatchupRequestMessage, slot: 1})
+	if len(replies) != 2 {
+		t.Fatalf("replies = %d, want 2 (slots 1 and 3)", len(replies))
+	}
+	for i, slot := range []int{1, 3} {
+		reply := replies[i]
+		if reply.slot != slot || reply.value != fmt.Sprintf("v%d", slot) ||
+			reply.messageRecipient != 201 || reply.messageCategory != CatchupReplyMessage {
+			t.Errorf("reply %d = %+v, want slot %d for learner 201", i, reply, slot)
+		}
+	}
+}
+
+func TestLearnerCatchupStartsAtFirstMissingSlot(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 200)
+	l := NewLearner(200, env.GetNodeNetwork(200), 1, 2, 3)
+	l.SetPeers(201, 202)
+	l.storage.SetDecided(0, []byte("alpha"))
+	l.storage.SetDecided(1, []byte("beta"))
+
+	requests := l.catchupRequests()
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want one per peer", len(requests))
+	}
+	for _, request := range requests {
+		if request.slot != 2 || request.messageCategory != CatchupRequestMessage {
+			t.Errorf("request = %+v, want a catch-up request from slot 2", request)
+		}
+	}
+}
+
+func TestLearnerServesSnapshotForCompactedSlots(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 200)
+	l := NewLearner(200, env.GetNodeNetwork(200), 1, 2, 3)
+	for slot := 0; slot < 5; slot++ {
+		l.storage.SetDecided(slot, []byte(fmt.Sprintf("v%d", slot)))
+	}
+	l.storage.SetSnapshot(Snapshot{Slot: 2, Data: []byte("state")})
+	l.compact(2)
+
+	replies := l.serveCatchup(messageData{messageSender: 201, messageCategory: CatchupRequestMessage, slot: 0})
+	if len(replies) != 3 {
+		t.Fatalf("replies = %d, want the snapshot and slots 3 and 4", len(replies))
+	}
+	if snap := replies[0]; snap.messageCategory != SnapshotMessage || snap.slot != 2 || snap.value != "state" {
+		t.Errorf("first reply = %+v, want the snapshot at slot 2", snap)
+	}
+	if replies[1].slot != 3 || replies[2].slot != 4 {
+		t.Errorf("replies cover slots %d and %d, want 3 and 4", replies[1].slot, replies[2].slot)
+	}
+
+	if l.decide(1, "late") {
+		t.Error("decide accepted a slot covered by the snapshot")
+	}
+	if l.nextSlot != 3 {
+		t.Errorf("nextSlot = %d, want 3 after compacting through slot 2", l.nextSlot)
+	}
+}
@@ -0,0 +1,27 @@
+package paxos
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler is a slog.Handler that drops every record. Its Enabled
+// reports false, so nothing is even formatted.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// discardLogger is the logger every role and Node starts with, so that
+// nothing is logged unless a logger is supplied.
+var discardLogger = slog.New(discardHandler{})
+
+// orDiscard returns l, or the discard logger if l is nil.
+func orDiscard(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return discardLogger
+	}
+	return l
+}
@@ -0,0 +1,257 @@
+package paxos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// configDelay is how many slots after its own a membership change takes
+// effect. A change decided in slot s governs slots s+configDelay onwards, so
+// the members of any slot are known once every slot configDelay before it is
+// decided. Slots further ahead than that wait, which bounds the pipeline.
+const configDelay = 16
+
+// configMagic starts every slot value that changes the membership. Such
+// slots are applied by the Node itself and never emitted on Committed.
+const configMagic = "\x00paxos/config\x00"
+
+const (
+	configAdd        byte = 1 // make a node a voting member
+	configRemove     byte = 2 // drop a node, voting or not
+	configAddLearner byte = 3 // make a node a learner-only member
+)
+
+// ErrMembership is returned for a membership change that would leave the
+// cluster without members, or that changes nothing.
+var ErrMembership = errors.New("invalid membership change")
+
+// encodeConfigChange builds the slot value that adds or removes member.
+func encodeConfigChange(op byte, member int) string {
+	buf := append([]byte(configMagic), op)
+	return string(binary.AppendVarint(buf, int64(member)))
+}
+
+// decodeConfigChange reads a value built by encodeConfigChange. It reports
+// false if value is not a membership change.
+func decodeConfigChange(value string) (byte, int, bool) {
+	if !strings.HasPrefix(value, configMagic) || len(value) < len(configMagic)+2 {
+		return 0, 0, false
+	}
+	op := value[len(configMagic)]
+	d := decoder{buf: []byte(value[len(configMagic)+1:])}
+	member := d.varint()
+	if d.err != nil || len(d.buf) != 0 || op < configAdd || op > configAddLearner {
+		return 0, 0, false
+	}
+	return op, member, true
+}
+
+// configChange is the membership in force from slot from on. Members vote;
+// learners only follow the log.
+type configChange struct {
+	from     int
+	members  []int
+	learners []int
+}
+
+// membership tracks which nodes are members for each slot. A Node shares one
+// between its roles. Standalone roles get a static one that never changes.
+// Only voting members count here; learner-only members are just told about
+// accepted values.
+type membership struct {
+	mu      sync.RWMutex
+	dynamic bool           // changes are applied from the log
+	changes []configChange // ascending by from, never empty
+	next    int            // every slot below next has been applied
+	version int            // bumped on every change
+}
+
+func newMembership(members []int, learners ...int) *membership {
+	change := configChange{members: slices.Clone(members), learners: slices.Clone(learners)}
+	slices.Sort(change.members)
+	slices.Sort(change.learners)
+	return &membership{changes: []configChange{change}}
+}
+
+// at returns the members governing slot. It reports false if a change that
+// could still affect slot has not been applied yet.
+func (m *membership) at(slot int) ([]int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.dynamic && slot >= m.next+configDelay {
+		return nil, false
+	}
+	for i := len(m.changes) - 1; i > 0; i-- {
+		if m.changes[i].from <= slot {
+			return m.changes[i].members, true
+		}
+	}
+	return m.changes[0].members, true
+}
+
+// latest returns the members once every change applied so far is in force.
+func (m *membership) latest() []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.changes[len(m.changes)-1].members
+}
+
+// lastChange returns the membership once every change applied so far is in
+// force.
+func (m *membership) lastChange() configChange {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.changes[len(m.changes)-1]
+}
+
+// latestLearners returns the learner-only members once every change applied
+// so far is in force.
+func (m *membership) latestLearners() []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.changes[len(m.changes)-1].learners
+}
+
+// current returns the latest members and the version they belong to.
+func (m *membership) current() ([]int, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.changes[len(m.changes)-1].members, m.version
+}
+
+// contains reports whether id is one of the latest members.
+func (m *membership) contains(id int) bool {
+	_, found := slices.BinarySearch(m.latest(), id)
+	return found
+}
+
+// recipients returns who hears about a vote in slot: the slot's members, the
+// latest ones so that new members learn without catching up, and the
+// learner-only members.
+func (m *membership) recipients(slot int) []int {
+	union := slices.Concat(m.latest(), m.latestLearners())
+	if members, ok := m.at(slot); ok {
+		union = append(union, members...)
+	}
+	slices.Sort(union)
+	return slices.Compact(union)
+}
+
+// apply records the change decided in slot, if value is one. Slots must be
+// applied in order; a slot applied before, such as one a restored snapshot
+// already covers, changes nothing.
+func (m *membership) apply(slot int, value string) {
+	op, member, ok := decodeConfigChange(value)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last := m.changes[len(m.changes)-1]
+	if slot+configDelay <= last.from {
+		return
+	}
+	next, err := last.change(op, member)
+	if err != nil {
+		return
+	}
+	next.from = slot + configDelay
+	m.changes = append(m.changes, next)
+	m.version++
+}
+
+// change returns c with member added or removed. A node is either a voter or
+// a learner-only member; switching means removing it first.
+func (c configChange) change(op byte, member int) (configChange, error) {
+	i, voter := slices.BinarySearch(c.members, member)
+	j, learner := slices.BinarySearch(c.learners, member)
+	next := configChange{members: slices.Clone(c.members), learners: slices.Clone(c.learners)}
+	switch {
+	case op == configAdd && !voter && !learner:
+		next.members = slices.Insert(next.members, i, member)
+	case op == configAddLearner && !voter && !learner:
+		next.learners = slices.Insert(next.learners, j, member)
+	case op == configRemove && voter && len(c.members) > 1:
+		next.members = slices.Delete(next.members, i, i+1)
+	case op == configRemove && learner:
+		next.learners = slices.Delete(next.learners, j, j+1)
+	default:
+		return configChange{}, ErrMembership
+	}
+	return next, nil
+}
+
+// advance notes that every slot below next has been applied.
+func (m *membership) advance(next int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next = max(m.next, next)
+}
+
+// compact forgets the changes that no slot after through is governed by.
+func (m *membership) compact(through int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	first := 0
+	for i := 1; i < len(m.changes) && m.changes[i].from <= through+1; i++ {
+		first = i
+	}
+	m.changes = m.changes[first:]
+}
+
+// snapshotState wraps an application snapshot with the membership history,
+// which a node restoring the snapshot needs for the slots after it.
+func (m *membership) snapshotState(data []byte) []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	buf := binary.AppendUvarint(nil, uint64(len(m.changes)))
+	for _, change := range m.changes {
+		buf = binary.AppendVarint(buf, int64(change.from))
+		for _, ids := range [][]int{change.members, change.learners} {
+			buf = binary.AppendUvarint(buf, uint64(len(ids)))
+			for _, id := range ids {
+				buf = binary.AppendVarint(buf, int64(id))
+			}
+		}
+	}
+	return append(buf, data...)
+}
+
+// decodeSnapshotState splits state built by snapshotState into the
+// membership history and the application's snapshot data.
+func decodeSnapshotState(state []byte) ([]configChange, []byte, error) {
+	d := decoder{buf: state}
+	count := d.varuint()
+	var changes []configChange
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		change := configChange{from: d.varint()}
+		for _, ids := range []*[]int{&change.members, &change.learners} {
+			count := d.varuint()
+			for j := uint64(0); j < count && d.err == nil; j++ {
+				*ids = append(*ids, d.varint())
+			}
+		}
+		changes = append(changes, change)
+	}
+	if d.err == nil && len(changes) == 0 {
+		d.err = fmt.Errorf("%w: snapshot without members", ErrMalformedMessage)
+	}
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return changes, d.buf, nil
+}
+
+// restore replaces the membership history with changes from a snapshot
+// covering every slot up to through.
+func (m *membership) restore(changes []configChange, through int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes = changes
+	m.next = max(m.next, through+1)
+	m.version++
+}
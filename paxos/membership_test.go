@@ -0,0 +1,123 @@
+package paxos
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConfigChangeRoundTrip(t *testing.T) {
+	op, member, ok := decodeConfigChange(encodeConfigChange(configRemove, 42))
+	if !ok || op != configRemove || member != 42 {
+		t.Errorf("decodeConfigChange = (%d, %d, %v), want (%d, 42, true)", op, member, ok, configRemove)
+	}
+	for _, value := range []string{"", "plain", configMagic, configMagic + "\x09\x02"} {
+		if _, _, ok := decodeConfigChange(value); ok {
+			t.Errorf("decodeConfigChange(%q) accepted a value that is not a change", value)
+		}
+	}
+}
+
+func TestMembershipChangeTakesEffectAfterDelay(t *testing.T) {
+	m := newMembership([]int{3, 1, 2})
+	m.dynamic = true
+	m.apply(4, encodeConfigChange(configAdd, 4))
+	m.apply(5, "not a change")
+	m.advance(6)
+
+	for _, tt := range []struct {
+		slot int
+		want string
+	}{
+		{0, "[1 2 3]"},
+		{4 + configDelay - 1, "[1 2 3]"},
+		{4 + configDelay, "[1 2 3 4]"},
+		{6 + configDelay - 1, "[1 2 3 4]"},
+	} {
+		members, ok := m.at(tt.slot)
+		if !ok || fmt.Sprint(members) != tt.want {
+			t.Errorf("at(%d) = (%v, %v), want %s", tt.slot, members, ok, tt.want)
+		}
+	}
+	// A change decided in slot 6 could still govern this slot.
+	if _, ok := m.at(6 + configDelay); ok {
+		t.Error("at() claims to know the members of a slot an undecided change may govern")
+	}
+	if got := fmt.Sprint(m.latest()); got != "[1 2 3 4]" {
+		t.Errorf("latest() = %s, want [1 2 3 4]", got)
+	}
+}
+
+func TestMembershipIgnoresReplayedAndInvalidChanges(t *testing.T) {
+	m := newMembership([]int{1, 2})
+	m.apply(3, encodeConfigChange(configRemove, 2))
+	m.apply(3, encodeConfigChange(configRemove, 2)) // replayed after a snapshot
+	m.apply(4, encodeConfigChange(configRemove, 1)) // would leave no members
+	m.apply(5, encodeConfigChange(configAdd, 1))    // already a member
+	if len(m.changes) != 2 || fmt.Sprint(m.latest()) != "[1]" {
+		t.Errorf("changes = %v, want only the removal of 2", m.changes)
+	}
+	if !m.contains(1) || m.contains(2) {
+		t.Errorf("contains: 1 = %v, 2 = %v; want true, false", m.contains(1), m.contains(2))
+	}
+}
+
+func TestMembershipLearners(t *testing.T) {
+	m := newMembership([]int{1, 2, 3})
+	m.apply(0, encodeConfigChange(configAddLearner, 5))
+	m.apply(1, encodeConfigChange(configAdd, 5))        // already a learner
+	m.apply(2, encodeConfigChange(configAddLearner, 1)) // already a voter
+	if got := fmt.Sprint(m.latest(), m.latestLearners()); got != "[1 2 3] [5]" {
+		t.Errorf("members and learners = %s, want [1 2 3] [5]", got)
+	}
+	if m.contains(5) {
+		t.Error("contains() counts a learner as a member")
+	}
+	if got := fmt.Sprint(m.recipients(0)); got != "[1 2 3 5]" {
+		t.Errorf("recipients(0) = %s, want the members and the learner", got)
+	}
+	m.apply(3, encodeConfigChange(configRemove, 5))
+	if len(m.latestLearners()) != 0 || len(m.changes) != 3 {
+		t.Errorf("changes = %v, want the learner added and removed", m.changes)
+	}
+}
+
+func TestMembershipSurvivesSnapshot(t *testing.T) {
+	m := newMembership([]int{1, 2, 3})
+	m.dynamic = true
+	m.apply(2, encodeConfigChange(configAdd, 4))
+	m.apply(30, encodeConfigChange(configRemove, 1))
+	m.advance(31)
+	m.compact(40) // the first change governs slot 41, so the initial members go
+	if len(m.changes) != 2 {
+		t.Fatalf("changes after compaction = %v, want the two changes", m.changes)
+	}
+
+	changes, data, err := decodeSnapshotState(m.snapshotState([]byte("app state")))
+	if err != nil || string(data) != "app state" {
+		t.Fatalf("decodeSnapshotState = (%q, %v), want the app state back", data, err)
+	}
+	restored := newMembership([]int{9})
+	restored.dynamic = true
+	restored.restore(changes, 40)
+	for _, slot := range []int{41, 30 + configDelay} {
+		want, _ := m.at(slot)
+		if got, ok := restored.at(slot); !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("restored at(%d) = (%v, %v), want %v", slot, got, ok, want)
+		}
+	}
+}
+
+func TestLearnerCountsOnlyMembersVotes(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 200)
+	l := NewLearner(200, env.GetNodeNetwork(200), 1, 2, 3)
+	ballot := Ballot{1, 100}
+	l.validateAcceptMessage(messageData{messageSender: 1, ballot: ballot, value: "v"})
+	l.validateAcceptMessage(messageData{messageSender: 9, ballot: ballot, value: "v"})
+	if _, ok := l.chosen(0); ok {
+		t.Error("a vote from a non-member made up a majority")
+	}
+	l.validateAcceptMessage(messageData{messageSender: 2, ballot: ballot, value: "v"})
+	if _, ok := l.chosen(0); !ok {
+		t.Error("two of three members' votes did not choose the value")
+	}
+}
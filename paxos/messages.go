@@ -1,23 +1,34 @@
 package paxos
 
-import "log/slog"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
 
 type messageType int
 
 const (
-	PrepareMessage   messageType = iota + 1
-	ProposeMessage               // propose a value - proposer - acceptor
-	AcceptMessage                // accept a given value - acceptor - learner
-	AckMessage                   // promise response - acceptor - proposer
-	HeartbeatMessage             // leader election heartbeat - proposer - proposer
+	PrepareMessage        messageType = iota + 1
+	ProposeMessage                    // propose a value - proposer - acceptor
+	AcceptMessage                     // accept a given value - acceptor - learner
+	AckMessage                        // promise response - acceptor - proposer
+	HeartbeatMessage                  // leader election heartbeat - proposer - proposer
+	NackMessage                       // rejection carrying the promised ballot - acceptor - proposer
+	AcceptedMessage                   // phase 2b acknowledgement - acceptor - proposer
+	CatchupRequestMessage             // ask for decided values from a slot on - learner - learner
+	CatchupReplyMessage               // one decided value - learner - learner
+	SnapshotMessage                   // state covering compacted slots - learner/acceptor - learner
 )
 
-var messages [5]string
+var messages [10]string
 
 type messageData struct {
-	messageSender    int // sender of the message
-	messageRecipient int // recipient of the message
-	messageNumber    int // current Sequence number of the message
+	messageSender    int    // sender of the message
+	messageRecipient int    // recipient of the message
+	ballot           Ballot // ballot of the proposal the message is about
+	promised         Ballot // for acks: the prepare ballot being promised
+	highestAccepted  int    // for acks: the highest slot the acceptor has accepted a value in
 	messageCategory  messageType
 	value            string // value contained in the string
 	timestamp        string
@@ -30,27 +41,44 @@ func init() {
 	messages[2] = "AcceptMessage"
 	messages[3] = "AckMessage"
 	messages[4] = "HeartbeatMessage"
+	messages[5] = "NackMessage"
+	messages[6] = "AcceptedMessage"
+	messages[7] = "CatchupRequestMessage"
+	messages[8] = "CatchupReplyMessage"
+	messages[9] = "SnapshotMessage"
+}
+
+func (t messageType) String() string {
+	if t < PrepareMessage || int(t) > len(messages) {
+		return fmt.Sprintf("messageType(%d)", int(t))
+	}
+	return messages[t-1]
 }
 
 func (m messageData) getProposalValue() string {
 	return m.value
 }
 
-func (m messageData) getMessageNumber() int {
-	return m.messageNumber
+func (m messageData) getBallot() Ballot {
+	return m.ballot
 }
 
 func (m messageData) getSlot() int {
 	return m.slot
 }
 
-func (m messageData) printMessage(str string) {
-	slog.Info(str,
+// printMessage logs m at Debug level. Messages are logged on every send and
+// receive, so nothing is formatted unless Debug is enabled.
+func (m messageData) printMessage(logger *slog.Logger, str string) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	logger.Debug(str,
 		"Source", m.messageSender,
 		"Destination", m.messageRecipient,
 		"Value", m.value,
-		"Sequence Number", m.messageNumber,
-		"Category", messages[m.messageCategory-1],
+		"Ballot", m.ballot,
+		"Category", m.messageCategory.String(),
 		"Slot", m.slot,
 	)
 }
@@ -0,0 +1,151 @@
+package paxos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metrics counts what a Node's roles do. Every role of a Node shares one; a
+// role created on its own gets its own, which nothing reads.
+type metrics struct {
+	sent     [len(messages)]atomic.Uint64 // by messageType-1
+	received [len(messages)]atomic.Uint64 // by messageType-1
+
+	retries       atomic.Uint64 // rounds abandoned and run again
+	backoffs      atomic.Uint64 // retries that waited before the next phase 1
+	nacksReceived atomic.Uint64 // rejections the proposer heard of
+	nacksSent     atomic.Uint64 // rejections the acceptor sent
+	leaderChanges atomic.Uint64
+
+	rounds        *histogram // rounds each decided slot took
+	commitLatency *histogram // seconds from a slot starting to its value being chosen
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		rounds:        newHistogram(1, 2, 3, 5, 10, 20),
+		commitLatency: newHistogram(.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10),
+	}
+}
+
+// countSent and countReceived ignore types the package does not know.
+func (m *metrics) countSent(t messageType) {
+	if t >= PrepareMessage && int(t) <= len(m.sent) {
+		m.sent[t-1].Add(1)
+	}
+}
+
+func (m *metrics) countReceived(t messageType) {
+	if t >= PrepareMessage && int(t) <= len(m.received) {
+		m.received[t-1].Add(1)
+	}
+}
+
+// histogram counts observations into buckets with the given upper bounds.
+type histogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// metricsWriter writes metrics in the Prometheus text exposition format.
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+func (mw metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (mw metricsWriter) value(name, labels string, v uint64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(mw.w, "%s%s %d\n", name, labels, v)
+}
+
+func (mw metricsWriter) counter(name, help string, v uint64) {
+	mw.header(name, "counter", help)
+	mw.value(name, "", v)
+}
+
+func (mw metricsWriter) byType(name, help string, counts []atomic.Uint64) {
+	mw.header(name, "counter", help)
+	for i := range counts {
+		label := strings.TrimSuffix(messageType(i+1).String(), "Message")
+		mw.value(name, `type="`+label+`"`, counts[i].Load())
+	}
+}
+
+func (mw metricsWriter) histogram(name, help string, h *histogram) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	mw.header(name, "histogram", help)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += counts[i]
+		mw.value(name+"_bucket", `le="`+strconv.FormatFloat(bound, 'g', -1, 64)+`"`, cumulative)
+	}
+	mw.value(name+"_bucket", `le="+Inf"`, count)
+	fmt.Fprintf(mw.w, "%s_sum %s\n", name, strconv.FormatFloat(sum, 'g', -1, 64))
+	mw.value(name+"_count", "", count)
+}
+
+// writeMetrics writes the Node's metrics to w in the Prometheus text format.
+func (n *Node) writeMetrics(w io.Writer) error {
+	m := n.metrics
+	mw := metricsWriter{w: bufio.NewWriter(w)}
+	mw.byType("paxos_messages_sent_total", "Messages sent, by type.", m.sent[:])
+	mw.byType("paxos_messages_received_total", "Messages received, by type.", m.received[:])
+	mw.histogram("paxos_slot_rounds", "Rounds of phase 1 or phase 2 each decided slot took.", m.rounds)
+	mw.counter("paxos_proposer_retries_total", "Rounds abandoned after a rejection or timeout.", m.retries.Load())
+	mw.counter("paxos_proposer_backoffs_total", "Retries that backed off before preparing again.", m.backoffs.Load())
+	mw.counter("paxos_proposer_nacks_received_total", "Rejections received from acceptors.", m.nacksReceived.Load())
+	mw.counter("paxos_acceptor_nacks_sent_total", "Prepares and proposals rejected for a higher promise.", m.nacksSent.Load())
+	mw.counter("paxos_acceptor_rejected_messages_total", "Unsupported or malformed messages rejected.", n.acceptor.Rejected())
+	mw.histogram("paxos_commit_latency_seconds", "Time from a slot starting to its value being chosen.", m.commitLatency)
+	mw.counter("paxos_leader_changes_total", "Times this node became or stopped being the leader.", m.leaderChanges.Load())
+
+	mw.header("paxos_queue_depth", "gauge", "Messages waiting for each role.")
+	mw.value("paxos_queue_depth", `queue="proposer"`, uint64(len(n.router.proposerCh)))
+	mw.value("paxos_queue_depth", `queue="acceptor"`, uint64(len(n.router.acceptorCh)))
+	mw.value("paxos_queue_depth", `queue="learner"`, uint64(len(n.router.learnerCh)))
+	return mw.w.Flush()
+}
+
+// MetricsHandler returns an http.Handler that serves the Node's metrics in
+// the Prometheus text format, for scraping.
+func (n *Node) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		n.writeMetrics(w)
+	})
+}
@@ -0,0 +1,88 @@
+package paxos
+
+import (
+	"bufio"
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape fetches n's metrics and returns each sample's value by its name
+// and labels, as written.
+func scrape(t *testing.T, n *Node) map[string]float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	n.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if i < 0 || err != nil {
+			t.Fatalf("malformed sample %q", line)
+		}
+		samples[line[:i]] = v
+	}
+	return samples
+}
+
+func TestNodeMetrics(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, nil)
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, v := range []string{"alpha", "beta"} {
+		if _, err := nodes[3].ProposeAndWait(ctx, []byte(v)); err != nil {
+			t.Fatalf("ProposeAndWait(%q): %v", v, err)
+		}
+	}
+
+	leader := scrape(t, nodes[3])
+	for _, name := range []string{
+		`paxos_messages_sent_total{type="Prepare"}`,
+		`paxos_messages_sent_total{type="Heartbeat"}`,
+		`paxos_messages_received_total{type="Accepted"}`,
+		`paxos_leader_changes_total`,
+	} {
+		if leader[name] < 1 {
+			t.Errorf("leader's %s = %v, want at least 1", name, leader[name])
+		}
+	}
+	if got := leader["paxos_commit_latency_seconds_count"]; got != 2 {
+		t.Errorf("commit latency count = %v, want 2", got)
+	}
+	if got := leader[`paxos_commit_latency_seconds_bucket{le="+Inf"}`]; got != 2 {
+		t.Errorf("commit latency +Inf bucket = %v, want 2", got)
+	}
+	// The second slot skips phase 1, so it takes one round like the first.
+	if got := leader[`paxos_slot_rounds_bucket{le="1"}`]; got != 2 {
+		t.Errorf("slots decided in one round = %v, want 2", got)
+	}
+	if _, ok := leader[`paxos_queue_depth{queue="learner"}`]; !ok {
+		t.Error("no learner queue depth")
+	}
+
+	follower := scrape(t, nodes[1])
+	for _, name := range []string{
+		`paxos_messages_received_total{type="Prepare"}`,
+		`paxos_messages_received_total{type="Heartbeat"}`,
+	} {
+		if follower[name] < 1 {
+			t.Errorf("follower's %s = %v, want at least 1", name, follower[name])
+		}
+	}
+	if got := follower["paxos_commit_latency_seconds_count"]; got != 0 {
+		t.Errorf("follower committed %v slots of its own, want 0", got)
+	}
+}
@@ -3,13 +3,23 @@ package paxos
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // ErrStopped is returned when an operation is attempted on a stopped Node.
 var ErrStopped = errors.New("node stopped")
 
+// ErrNotChosen is returned by ProposeAndWait when another value won the slot.
+var ErrNotChosen = errors.New("another value was chosen")
+
+// ErrLearnerOnly is returned when a learner-only Node is asked to propose.
+var ErrLearnerOnly = errors.New("node is learner-only")
+
 // routedNode implements nodeNetwork for a single role within a Node.
 // It routes messages either locally (between co-located roles) or
 // externally (via the Transport).
@@ -22,9 +32,11 @@ type routedNode struct {
 func (rn *routedNode) send(m messageData) {
 	m.timestamp = time.Now().String()
 	if m.messageRecipient == rn.nodeID {
+		rn.router.metrics.countSent(m.messageCategory)
 		rn.router.deliverLocal(m)
 		return
 	}
+	rn.router.metrics.countSent(m.messageCategory)
 	rn.router.transport.Send(toPublicMessage(m))
 }
 
@@ -47,21 +59,33 @@ func (rn *routedNode) receiveWithTimeout(timeout time.Duration) *messageData {
 // messageRouter is the central routing hub shared by all 3 routedNodes within a Node.
 type messageRouter struct {
 	nodeID     int
+	learnOnly  bool // drop proposer and acceptor traffic, which nothing reads
 	transport  Transport
 	proposerCh chan messageData
 	acceptorCh chan messageData
 	learnerCh  chan messageData
+	metrics    *metrics
+	reject     func(error) // reports a message that cannot be routed or decoded
 	ctx        context.Context
 	cancel     context.CancelFunc
 }
 
 func (mr *messageRouter) queueFor(mt messageType) chan messageData {
+	if mr.learnOnly {
+		// A learner-only node reads heartbeats only for how far the
+		// log is decided, to notice when it has fallen behind.
+		switch mt {
+		case AcceptMessage, CatchupRequestMessage, CatchupReplyMessage, SnapshotMessage, HeartbeatMessage:
+			return mr.learnerCh
+		}
+		return nil
+	}
 	switch mt {
 	case PrepareMessage, ProposeMessage:
 		return mr.acceptorCh
-	case AckMessage, HeartbeatMessage:
+	case AckMessage, HeartbeatMessage, NackMessage, AcceptedMessage:
 		return mr.proposerCh
-	case AcceptMessage:
+	case AcceptMessage, CatchupRequestMessage, CatchupReplyMessage, SnapshotMessage:
 		return mr.learnerCh
 	default:
 		return nil
@@ -71,8 +95,10 @@ func (mr *messageRouter) queueFor(mt messageType) chan messageData {
 func (mr *messageRouter) deliverLocal(m messageData) {
 	ch := mr.queueFor(m.messageCategory)
 	if ch == nil {
+		mr.reject(fmt.Errorf("%w: %v from %d", ErrUnsupportedMessage, m.messageCategory, m.messageSender))
 		return
 	}
+	mr.metrics.countReceived(m.messageCategory)
 	select {
 	case ch <- m:
 	case <-mr.ctx.Done():
@@ -82,6 +108,10 @@ func (mr *messageRouter) deliverLocal(m messageData) {
 func (mr *messageRouter) run() {
 	for {
 		msg, err := mr.transport.Receive(mr.ctx)
+		if isCodecError(err) {
+			mr.reject(err)
+			continue
+		}
 		if err != nil {
 			return
 		}
@@ -98,14 +128,54 @@ type Node struct {
 	learner   *Learner
 	router    *messageRouter
 	committed chan Entry
+	unordered bool // deliver slots as decided rather than in slot order
+	learnOnly bool // follow the log without voting or proposing
+	members   *membership
+	clock     Clock
+	logger    *slog.Logger
+	metrics   *metrics
+	observer  Observer
 	done      chan struct{}
 	stopOnce  sync.Once
+
+	// onCommit, if set, takes decided entries in place of Committed. A
+	// Simulation uses it, since nothing there reads the channel concurrently.
+	onCommit func(Entry)
+
+	membersVersion int // the membership version the peers were last set from
+	nextSlot       int // the slot after the last one proposed in
+	catchupGap     int // the missing slot seen at the last catch-up check, or -1
+
+	// The leader fills holes in the log; see fillGaps.
+	filledBelow int   // every slot below it is decided
+	holes       []int // undecided slots seen at the last check
+
+	// published is the proposer's and learner's latest status, copied out
+	// by their goroutines as they go; see status.
+	published publishedStatus
+	started   atomic.Bool
+
+	snapshotter   Snapshotter
+	snapshotEvery int // slots delivered between snapshots
+	lastSnapshot  int // the learner's next slot when a snapshot was last taken
+
+	// decidedNext is one past the highest slot the learner has decided.
+	decidedNext atomic.Int64
+	// peersDecided is the highest decidedNext a peer has sent in a heartbeat.
+	peersDecided atomic.Int64
+	// installed is the highest slot a snapshot from a peer has covered, or -1.
+	installed atomic.Int64
 }
 
 // NewNode creates a Node that participates in Paxos consensus.
 // id is this node's unique identifier. peerIDs are the other nodes in the cluster.
 // transport is the networking layer for inter-node communication.
-func NewNode(id int, peerIDs []int, transport Transport) *Node {
+func NewNode(id int, peerIDs []int, transport Transport, opts ...Option) *Node {
+	var cfg nodeConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	allIDs := make([]int, 0, 1+len(peerIDs))
 	allIDs = append(allIDs, id)
 	allIDs = append(allIDs, peerIDs...)
@@ -118,6 +188,8 @@ func NewNode(id int, peerIDs []int, transport Transport) *Node {
 		proposerCh: make(chan messageData, 1024),
 		acceptorCh: make(chan messageData, 1024),
 		learnerCh:  make(chan messageData, 1024),
+		metrics:    newMetrics(),
+		learnOnly:  cfg.learnerOnly,
 		ctx:        ctx,
 		cancel:     cancel,
 	}
@@ -130,76 +202,498 @@ func NewNode(id int, peerIDs []int, transport Transport) *Node {
 	proposer.SetPeers(peerIDs...)
 
 	acceptor := NewAcceptor(id, acceptorNode, allIDs...)
+	// Messages the router cannot place are reported with the acceptor's.
+	router.reject = acceptor.reject
 	learner := NewLearner(id, learnerNode, allIDs...)
+	learner.SetPeers(peerIDs...)
+	if cfg.storage != nil {
+		acceptor.SetStorage(cfg.storage)
+		learner.SetStorage(cfg.storage)
+	}
+	// The roles share one membership, which changes as the log is applied.
+	members := newMembership(allIDs)
+	if cfg.learnerOnly {
+		members = newMembership(peerIDs, id)
+	}
+	members.dynamic = true
+	proposer.members = members
+	acceptor.learners = members
+	learner.members = members
+	if snap, ok := learner.storage.Snapshot(); ok {
+		if changes, _, err := decodeSnapshotState(snap.Data); err == nil {
+			members.restore(changes, snap.Slot)
+		}
+	}
+	// Replay the membership changes among the slots already decided.
+	learner.drain()
+	if cfg.window > 0 {
+		proposer.SetWindow(cfg.window)
+	}
+	if b := cfg.batch; b != nil {
+		proposer.SetBatching(b.maxDelay, b.maxBytes, b.maxCount)
+	}
+	clock := cfg.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	proposer.clock = clock
+	if cfg.rng != nil {
+		proposer.rng = cfg.rng
+	}
+	proposer.metrics = router.metrics
+	acceptor.metrics = router.metrics
+	proposer.observer = cfg.observer
+	acceptor.observer = cfg.observer
+	proposer.SetLogger(cfg.logger)
+	acceptor.SetLogger(cfg.logger)
+	learner.SetLogger(cfg.logger)
 
-	return &Node{
+	n := &Node{
 		id:        id,
 		proposer:  proposer,
 		acceptor:  acceptor,
 		learner:   learner,
 		router:    router,
 		committed: make(chan Entry, 64),
+		unordered: cfg.unordered,
+		learnOnly: cfg.learnerOnly,
+		members:   members,
+		clock:     clock,
+		logger:    orDiscard(cfg.logger).With("Node ID", id),
+		metrics:   router.metrics,
+		observer:  cfg.observer,
 		done:      make(chan struct{}),
+
+		snapshotter:   cfg.snapshotter,
+		snapshotEvery: cfg.snapshotEvery,
 	}
+	n.installed.Store(-1)
+	n.decidedNext.Store(int64(decidedThrough(learner)))
+	proposer.decided = &n.decidedNext
+	n.membersVersion = -1
+	n.catchupGap = -1
+	n.syncMembers()
+	return n
 }
 
 // Start launches the background goroutines that drive the Paxos protocol.
+// A learner-only Node runs just its learner.
 func (n *Node) Start(ctx context.Context) {
+	// Publish before the goroutines that own the state start changing it.
+	n.publishLearnerStatus()
+	if !n.learnOnly {
+		n.publishProposerStatus()
+	}
+	n.started.Store(true)
 	go n.router.run()
+	go n.runLearner()
+	if n.learnOnly {
+		return
+	}
 	go n.acceptor.Accept()
+	go n.runHeartbeats()
 	go n.runProposer()
-	go n.runLearner()
 }
 
-func (n *Node) runProposer() {
-	n.proposer.electLeader()
-	if !n.proposer.isLeader {
-		return
+// runHeartbeats keeps peers' failure detectors fed for as long as the Node runs.
+func (n *Node) runHeartbeats() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.proposer.sendHeartbeats()
+		case <-n.done:
+			return
+		}
 	}
-	slot := 0
+}
+
+// runProposer proposes queued values while this Node is the leader, keeping
+// up to the proposer's window of slots in flight. Followers only watch
+// heartbeats, and take over when the leader stops sending them.
+func (n *Node) runProposer() {
+	p := n.proposer
+	p.electLeader()
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
 	for {
+		var values chan proposal
+		if n.takesValues() {
+			values = p.values
+		}
+		wait := time.NewTimer(n.proposerWait())
 		select {
-		case value, ok := <-n.proposer.values:
+		case prop, ok := <-values:
 			if !ok {
+				wait.Stop()
 				return
 			}
-			n.proposer.runSlot(slot, value)
-			slot++
+			n.queueProposal(prop)
+		case msg := <-n.router.proposerCh:
+			n.handleProposerMessage(msg)
+		case <-wait.C:
+		case <-ticker.C:
+			n.checkLeader()
 		case <-n.done:
+			wait.Stop()
 			return
 		}
+		wait.Stop()
+		n.proposerTick()
+		n.publishProposerStatus()
+	}
+}
+
+// takesValues reports whether the proposer has room for another value: it
+// leads, and its window is not full.
+func (n *Node) takesValues() bool {
+	return n.proposer.isLeader && len(n.proposer.instances) < n.proposer.window
+}
+
+// proposerWait returns how long the proposer can wait for a message before
+// proposerTick has work to do.
+func (n *Node) proposerWait() time.Duration {
+	p := n.proposer
+	now := n.clock.Now()
+	wait := p.untilNext(now)
+	if p.batch != nil && len(p.batch.pending) > 0 {
+		wait = min(wait, p.batch.deadline.Sub(now))
+	}
+	return wait
+}
+
+// queueProposal starts prop in the next slot, or adds it to the pending batch.
+func (n *Node) queueProposal(prop proposal) {
+	p := n.proposer
+	if _, _, config := decodeConfigChange(prop.value); p.batch == nil || config {
+		n.startProposal(prop)
+	} else if p.batch.add(prop, n.clock.Now()) {
+		n.startProposal(p.batch.take())
+	}
+}
+
+// handleProposerMessage feeds a reply or heartbeat to the proposer, and
+// reports on the slot it decided.
+func (n *Node) handleProposerMessage(msg messageData) {
+	msg.printMessage(n.proposer.logger, "Proposer received message")
+	if msg.messageCategory == HeartbeatMessage {
+		n.notePeerDecided(msg.slot)
+	}
+	inst := n.proposer.handle(msg, n.clock.Now())
+	if inst == nil {
+		return
+	}
+	// Whoever hears of the decision may ask for the status next.
+	n.publishProposerStatus()
+	n.proposer.report(inst)
+	// The acceptors' votes may all be lost on their way to the learners,
+	// leaving a gap nobody can fill. The proposer knows the value is
+	// chosen, so its own learner hears it directly and the others catch
+	// up from there.
+	n.router.deliverLocal(messageData{
+		messageSender:    n.id,
+		messageRecipient: n.id,
+		messageCategory:  CatchupReplyMessage,
+		value:            inst.proposalValue,
+		slot:             inst.slot,
+	})
+	// Values that lost their slot to an earlier leader's value are
+	// retried, unless the caller is waiting to hear about them.
+	if inst.adopted && inst.prop.value != noopValue {
+		if retry, ok := inst.prop.unanswered(); ok {
+			n.startProposal(retry)
+		}
 	}
 }
 
+// proposerTick sends a batch that has waited long enough, re-proposes values
+// a snapshot overtook, and retries phases that are overdue.
+func (n *Node) proposerTick() {
+	p := n.proposer
+	if p.batch != nil && p.batch.due(n.clock.Now()) && len(p.instances) < p.window {
+		n.startProposal(p.batch.take())
+	}
+	if through := int(n.installed.Load()); through >= 0 {
+		// A snapshot overtook these slots before this node learned how
+		// they were decided. Their values may or may not have made it
+		// in, so they are proposed again.
+		for _, inst := range p.forget(through) {
+			n.startProposal(inst.prop)
+		}
+	}
+	p.tick(n.clock.Now())
+}
+
+// noopValue fills a slot that a new leader found no value in. Such slots
+// are skipped on Committed.
+const noopValue = "\x00paxos/noop\x00"
+
+// checkLeader re-runs the leader election and, while this Node leads, fills
+// the holes in the log.
+func (n *Node) checkLeader() {
+	n.proposer.checkLeader()
+	n.fillGaps()
+}
+
+// fillGaps runs phase 1 on each undecided slot below the highest one decided,
+// unless it is already in flight here. A leader that fails with several
+// slots in flight can leave such a hole under a decided slot, and ordered
+// delivery waits on it for good. Phase 1 recovers any value the acceptors
+// hold for the slot, or else settles it on a no-op. A hole is only filled
+// once it has outlasted a check, since this node's learner may not yet have
+// heard of a slot its proposer just decided.
+func (n *Node) fillGaps() {
+	p := n.proposer
+	if !p.isLeader {
+		n.holes = nil
+		return
+	}
+	storage := n.learner.storage
+	n.filledBelow = max(n.filledBelow, compactedThrough(storage)+1)
+	var holes []int
+	for slot := n.filledBelow; slot < int(n.decidedNext.Load()); slot++ {
+		if _, ok := storage.Decided(slot); ok {
+			if slot == n.filledBelow {
+				n.filledBelow++
+			}
+			continue
+		}
+		if _, ok := p.instances[slot]; !ok {
+			holes = append(holes, slot)
+		}
+	}
+	// Holes do not wait for room in the window: slots in flight further on
+	// may be waiting on them, for their members if nothing else. Up to a
+	// window's worth are filled at a time.
+	filling := 0
+	for _, slot := range holes {
+		if slices.Contains(n.holes, slot) && filling < p.window {
+			p.fill(slot, n.clock.Now())
+			filling++
+		}
+	}
+	n.holes = holes
+}
+
+// startProposal puts prop in the next free slot. Slots resume after whatever
+// this node has seen decided or compacted away, so a new leader does not
+// re-run slots its predecessor already filled.
+func (n *Node) startProposal(prop proposal) {
+	slot := max(n.nextSlot, int(n.decidedNext.Load()), compactedThrough(n.learner.storage)+1)
+	n.proposer.start(slot, prop, n.clock.Now())
+	n.nextSlot = slot + 1
+}
+
+// catchupInterval is how often a learner checks whether it is stuck on a
+// missing slot. A gap still open after a full interval is not just a
+// pipelined slot running late, so the learner asks its peers to fill it.
+const catchupInterval = 250 * time.Millisecond
+
 func (n *Node) runLearner() {
-	decided := make(map[int]bool)
+	// A node starting with an empty or stale log asks its peers what it missed.
+	n.requestCatchup()
+	ticker := time.NewTicker(catchupInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case msg := <-n.router.learnerCh:
-			n.learner.validateAcceptMessage(msg)
-			chosen, ok := n.learner.chosen(msg.slot)
-			if ok && !decided[msg.slot] {
-				decided[msg.slot] = true
-				entry := Entry{
-					Slot:  msg.slot,
-					Value: []byte(chosen.value),
-				}
-				select {
-				case n.committed <- entry:
-				case <-n.done:
-					return
-				}
+			if !n.handleLearnerMessage(msg) {
+				return
 			}
+		case <-ticker.C:
+			n.checkCatchup()
 		case <-n.done:
 			return
 		}
+		n.publishLearnerStatus()
 	}
 }
 
+// handleLearnerMessage feeds a vote, catch-up message or snapshot to the
+// learner. It returns false if the Node stopped while delivering.
+func (n *Node) handleLearnerMessage(msg messageData) bool {
+	switch msg.messageCategory {
+	case AcceptMessage:
+		n.learner.validateAcceptMessage(msg)
+		if chosen, ok := n.learner.chosen(msg.slot); ok {
+			return n.learn(msg.slot, chosen.value)
+		}
+	case CatchupRequestMessage:
+		for _, reply := range n.learner.serveCatchup(msg) {
+			n.learner.node.send(reply)
+		}
+	case CatchupReplyMessage:
+		return n.learn(msg.slot, msg.value)
+	case SnapshotMessage:
+		return n.installSnapshot(msg)
+	case HeartbeatMessage:
+		n.notePeerDecided(msg.slot)
+	}
+	return true
+}
+
+// notePeerDecided records that a peer has decided every slot below decided.
+func (n *Node) notePeerDecided(decided int) {
+	if int64(decided) > n.peersDecided.Load() {
+		n.peersDecided.Store(int64(decided))
+	}
+}
+
+// checkCatchup asks the peers for the first missing slot if it was already
+// missing at the previous check. A slot counts as missing if a later one is
+// pending, or if a peer has decided it: a learner that lost the votes for the
+// tail of the log has nothing pending, and keeps asking until it catches up.
+func (n *Node) checkCatchup() {
+	behind := n.learner.lagging() || int(n.peersDecided.Load()) > n.learner.nextSlot
+	if !behind {
+		n.catchupGap = -1
+		return
+	}
+	if n.learner.nextSlot == n.catchupGap {
+		n.requestCatchup()
+	}
+	n.catchupGap = n.learner.nextSlot
+}
+
+func (n *Node) requestCatchup() {
+	for _, request := range n.learner.catchupRequests() {
+		n.learner.node.send(request)
+	}
+}
+
+// decidedThrough returns one past the highest slot a restarting learner
+// finds decided in its storage: the slots it drained in order, and any decided
+// beyond a gap among those accepted in here.
+func decidedThrough(l *Learner) int {
+	next := l.nextSlot
+	for slot := next; slot <= l.storage.HighestAccepted(); slot++ {
+		if _, ok := l.storage.Decided(slot); ok {
+			next = slot + 1
+		}
+	}
+	return next
+}
+
+// learn records value as decided for slot and delivers every entry that is
+// now in order. It returns false if the Node stopped while delivering.
+func (n *Node) learn(slot int, value string) bool {
+	if !n.learner.decide(slot, value) {
+		return true
+	}
+	notify(n.observer, Event{Type: SlotChosen, Node: n.id, Slot: slot, Value: []byte(value)})
+	from := n.learner.nextSlot
+	if next := int64(slot + 1); next > n.decidedNext.Load() {
+		n.decidedNext.Store(next)
+	}
+	// Slots may be decided out of order while several are in flight;
+	// Committed still sees them in slot order unless asked not to. The
+	// learner tracks the order either way, to notice gaps to catch up on.
+	ready := n.learner.ready(Entry{Slot: slot, Value: []byte(value)})
+	if n.unordered {
+		ready = []Entry{{Slot: slot, Value: []byte(value)}}
+	}
+	if !n.deliver(ready) {
+		return false
+	}
+	n.maybeSnapshot()
+	return n.learnUnblocked(from)
+}
+
+// learnUnblocked follows up on the learner moving on from slot from: the
+// peers may have changed, and slots whose members were not known until now
+// may already have enough votes.
+func (n *Node) learnUnblocked(from int) bool {
+	n.syncMembers()
+	for _, slot := range n.learner.votedSlots(from+configDelay, n.learner.nextSlot+configDelay) {
+		if chosen, ok := n.learner.chosen(slot); ok && !n.learn(slot, chosen.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// syncMembers points heartbeats and catch-up requests at the latest members.
+func (n *Node) syncMembers() {
+	latest, version := n.members.current()
+	if version == n.membersVersion {
+		return
+	}
+	n.membersVersion = version
+	var peers []int
+	for _, id := range latest {
+		if id != n.id {
+			peers = append(peers, id)
+		}
+	}
+	n.proposer.SetPeers(peers...)
+	n.learner.SetPeers(peers...)
+}
+
+// deliver emits the entries of each decided slot on Committed. It returns
+// false if the Node stopped first.
+func (n *Node) deliver(ready []Entry) bool {
+	// Delivering may block on Committed, so the status already counts
+	// these entries as delivered.
+	n.publishLearnerStatus()
+	for _, decided := range ready {
+		if _, _, config := decodeConfigChange(string(decided.Value)); config {
+			continue // applied by the learner, not the application
+		}
+		if string(decided.Value) == noopValue {
+			continue
+		}
+		entries := []Entry{decided}
+		if n.proposer.batch != nil {
+			entries = unbatch(decided.Slot, string(decided.Value))
+		}
+		for _, entry := range entries {
+			if n.onCommit != nil {
+				n.onCommit(entry)
+				continue
+			}
+			select {
+			case n.committed <- entry:
+			case <-n.done:
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // Propose submits a value for consensus.
 func (n *Node) Propose(ctx context.Context, value []byte) error {
+	return n.submit(ctx, proposal{value: string(value)})
+}
+
+// ProposeAndWait submits a value and waits until its slot is decided. It
+// returns the decided Entry; if a different value won that slot, the Entry
+// holds the winning value and the error is ErrNotChosen.
+func (n *Node) ProposeAndWait(ctx context.Context, value []byte) (Entry, error) {
+	done := make(chan outcome, 1)
+	if err := n.submit(ctx, proposal{value: string(value), done: done}); err != nil {
+		return Entry{}, err
+	}
 	select {
-	case n.proposer.values <- string(value):
+	case out := <-done:
+		if !out.chosen {
+			return out.entry, fmt.Errorf("%w: slot %d", ErrNotChosen, out.entry.Slot)
+		}
+		return out.entry, nil
+	case <-ctx.Done():
+		return Entry{}, ctx.Err()
+	case <-n.done:
+		return Entry{}, ErrStopped
+	}
+}
+
+func (n *Node) submit(ctx context.Context, prop proposal) error {
+	if n.learnOnly {
+		return ErrLearnerOnly
+	}
+	select {
+	case n.proposer.values <- prop:
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -208,15 +702,85 @@ func (n *Node) Propose(ctx context.Context, value []byte) error {
 	}
 }
 
-// Committed returns a channel that emits decided entries.
+// AddMember makes id a member of the cluster by committing a membership
+// change. Like Propose, it waits for this Node to lead. The change governs
+// slots from a fixed number after the one it is decided in, so every node
+// switches quorums at the same slot. The Transport must already reach id; the
+// new node is started with the current members as its peers and catches up
+// from them. Replacing a dead machine is a RemoveMember and an AddMember;
+// changing one member at a time keeps every two quorums overlapping.
+func (n *Node) AddMember(ctx context.Context, id int) error {
+	return n.changeMembership(ctx, configAdd, id)
+}
+
+// RemoveMember stops id from being a member of the cluster, the same way
+// AddMember adds one.
+func (n *Node) RemoveMember(ctx context.Context, id int) error {
+	return n.changeMembership(ctx, configRemove, id)
+}
+
+func (n *Node) changeMembership(ctx context.Context, op byte, id int) error {
+	if _, err := n.members.lastChange().change(op, id); err != nil {
+		return fmt.Errorf("%w: node %d", err, id)
+	}
+	value := []byte(encodeConfigChange(op, id))
+	for {
+		// A slot lost to another value says nothing about this change.
+		if _, err := n.ProposeAndWait(ctx, value); !errors.Is(err, ErrNotChosen) {
+			return err
+		}
+	}
+}
+
+// AddLearner makes id a learner-only member: it is sent every accepted value
+// but never votes, so it does not count toward any quorum. The node itself
+// is created with WithLearnerOnly. It takes effect like AddMember, and
+// RemoveMember removes it again.
+func (n *Node) AddLearner(ctx context.Context, id int) error {
+	return n.changeMembership(ctx, configAddLearner, id)
+}
+
+// Members returns the cluster's voting members once every membership change
+// this Node has learned of is in force.
+func (n *Node) Members() []int {
+	return slices.Clone(n.members.latest())
+}
+
+// Learners returns the cluster's learner-only members once every membership
+// change this Node has learned of is in force.
+func (n *Node) Learners() []int {
+	return slices.Clone(n.members.latestLearners())
+}
+
+// Committed returns a channel that emits decided entries. Entries arrive in
+// ascending slot order, and by Index within a batched slot, so they can be
+// applied to a state machine as they come; a slot decided early is held back
+// until every slot before it is decided. A Node created with
+// WithUnorderedDelivery emits each slot as soon as it is decided instead.
 func (n *Node) Committed() <-chan Entry {
 	return n.committed
 }
 
+// Errors returns a channel that receives an error for each message the Node
+// rejected: one of a type it does not handle, one its Transport could not
+// decode, or one that is malformed. The Node keeps serving regardless.
+// Errors nobody reads are dropped once the channel's buffer is full, but
+// Rejected still counts them.
+func (n *Node) Errors() <-chan error {
+	return n.acceptor.Errors()
+}
+
+// Rejected returns how many messages the Node has rejected, for any of the
+// reasons Errors reports.
+func (n *Node) Rejected() uint64 {
+	return n.acceptor.Rejected()
+}
+
 // Stop gracefully shuts down the Node.
 func (n *Node) Stop() {
 	n.stopOnce.Do(func() {
 		close(n.done)
+		n.proposer.Stop()
 		n.acceptor.Stop()
 		n.router.cancel()
 	})
@@ -1,11 +1,78 @@
 package paxos
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// startTestCluster starts a Node per id over in-process transports and stops
+// them when the test ends. optsFor, if non-nil, supplies per-node options.
+func startTestCluster(t *testing.T, ids []int, optsFor func(id int) []Option) map[int]*Node {
+	t.Helper()
+	transports := NewChannelTransportGroup(ids...)
+	nodes := make(map[int]*Node)
+	for _, id := range ids {
+		var peerIDs []int
+		for _, pid := range ids {
+			if pid != id {
+				peerIDs = append(peerIDs, pid)
+			}
+		}
+		var opts []Option
+		if optsFor != nil {
+			opts = optsFor(id)
+		}
+		nodes[id] = NewNode(id, peerIDs, transports[id], opts...)
+	}
+	for _, node := range nodes {
+		node.Start(context.Background())
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+	})
+	return nodes
+}
+
+// waitForLeader waits until leader leads and every other node follows it.
+func waitForLeader(t *testing.T, nodes map[int]*Node, leader int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		settled := true
+		for id, node := range nodes {
+			if node.learnOnly {
+				continue
+			}
+			s, err := node.status()
+			if err != nil {
+				t.Fatalf("node %d status: %v", id, err)
+			}
+			leading := s.Proposer != nil && s.Proposer.Leading
+			if s.Leader != leader || leading != (id == leader) {
+				settled = false
+			}
+		}
+		if settled {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node %d did not become leader", leader)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TestNodeSingleValue(t *testing.T) {
 	ids := []int{1, 2, 3}
 	transports := NewChannelTransportGroup(ids...)
@@ -32,7 +99,7 @@ func TestNodeSingleValue(t *testing.T) {
 	}()
 
 	// Wait for leader election
-	time.Sleep(700 * time.Millisecond)
+	waitForLeader(t, nodes, 3)
 
 	// Node 3 (highest ID) is the leader
 	if err := nodes[3].Propose(ctx, []byte("hello")); err != nil {
@@ -77,7 +144,7 @@ func TestNodeMultiDecree(t *testing.T) {
 		}
 	}()
 
-	time.Sleep(700 * time.Millisecond)
+	waitForLeader(t, nodes, 3)
 
 	// Propose 3 values on the leader (node 3)
 	values := []string{"alpha", "beta", "gamma"}
@@ -125,7 +192,7 @@ func TestNodeLeaderElection(t *testing.T) {
 	}()
 
 	// Wait for election
-	time.Sleep(700 * time.Millisecond)
+	waitForLeader(t, map[int]*Node{1: node1, 2: node2}, 2)
 
 	// Node 2 (higher ID) wins election
 	if err := node2.Propose(ctx, []byte("from-leader")); err != nil {
@@ -144,3 +211,638 @@ func TestNodeLeaderElection(t *testing.T) {
 		}
 	}
 }
+
+func TestNodeProposeAndWait(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, nil)
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	for i, v := range []string{"alpha", "beta", "gamma"} {
+		entry, err := nodes[3].ProposeAndWait(ctx, []byte(v))
+		if err != nil {
+			t.Fatalf("ProposeAndWait(%q): %v", v, err)
+		}
+		if entry.Slot != i || string(entry.Value) != v {
+			t.Errorf("ProposeAndWait(%q) = slot %d value %q, want slot %d", v, entry.Slot, entry.Value, i)
+		}
+	}
+}
+
+func TestNodeProposeAndWaitLosesSlot(t *testing.T) {
+	// Nodes 1 and 2 already accepted "earlier" for slot 0 from a previous leader.
+	nodes := startTestCluster(t, []int{1, 2, 3}, func(id int) []Option {
+		storage := NewMemoryStorage()
+		if id != 3 {
+			storage.SetPromised(0, Message{From: 2, Type: PrepareMsg, Ballot: Ballot{1, 2}})
+			storage.SetAccepted(0, Message{From: 2, Type: ProposeMsg, Ballot: Ballot{1, 2}, Value: []byte("earlier")})
+		}
+		return []Option{WithStorage(storage)}
+	})
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	entry, err := nodes[3].ProposeAndWait(ctx, []byte("mine"))
+	if !errors.Is(err, ErrNotChosen) {
+		t.Fatalf("ProposeAndWait error = %v, want %v", err, ErrNotChosen)
+	}
+	if entry.Slot != 0 || string(entry.Value) != "earlier" {
+		t.Errorf("entry = slot %d value %q, want slot 0 value %q", entry.Slot, entry.Value, "earlier")
+	}
+}
+
+func TestNodeProposeAndWaitContextExpires(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2}, nil)
+	waitForLeader(t, nodes, 2)
+
+	// Node 1 is a follower, so its proposal is never run.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := nodes[1].ProposeAndWait(ctx, []byte("ignored")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ProposeAndWait error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestNodeLeaderFailover(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, nil)
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if _, err := nodes[3].ProposeAndWait(ctx, []byte("before")); err != nil {
+		t.Fatalf("ProposeAndWait on first leader: %v", err)
+	}
+
+	// Kill the leader. Node 2 is now the highest live ID and must take over
+	// once node 3's heartbeats stop.
+	nodes[3].Stop()
+	waitForLeader(t, map[int]*Node{1: nodes[1], 2: nodes[2]}, 2)
+
+	entry, err := nodes[2].ProposeAndWait(ctx, []byte("after"))
+	if err != nil {
+		t.Fatalf("ProposeAndWait on new leader: %v", err)
+	}
+	if entry.Slot != 1 {
+		t.Errorf("new leader decided slot %d, want the next free slot 1", entry.Slot)
+	}
+
+	// The surviving follower learns both decisions.
+	decided := make(map[int]string)
+	for len(decided) < 2 {
+		select {
+		case e := <-nodes[1].Committed():
+			decided[e.Slot] = string(e.Value)
+		case <-ctx.Done():
+			t.Fatalf("node 1 learned only %v", decided)
+		}
+	}
+	if decided[0] != "before" || decided[1] != "after" {
+		t.Errorf("node 1 learned %v, want slot 0 %q and slot 1 %q", decided, "before", "after")
+	}
+}
+
+func TestNodeFollowerStaysFollowerWhileLeaderAlive(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2}, nil)
+	waitForLeader(t, nodes, 2)
+	time.Sleep(2 * leaderTimeout)
+
+	// Node 2 keeps sending heartbeats, so node 1 must not take over.
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := nodes[1].ProposeAndWait(ctx, []byte("ignored")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("follower ProposeAndWait error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestNodeRestartsAfterDecidedSlots(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, func(int) []Option {
+		storage := NewMemoryStorage()
+		for slot := 0; slot < 5; slot++ {
+			storage.SetDecided(slot, []byte(fmt.Sprintf("v%d", slot)))
+		}
+		return []Option{WithStorage(storage)}
+	})
+	waitForLeader(t, nodes, 3)
+
+	s, err := nodes[3].status()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if s.Learner.HighestDecided != 4 {
+		t.Errorf("highestDecided = %d after restart, want 4", s.Learner.HighestDecided)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	entry, err := nodes[3].ProposeAndWait(ctx, []byte("x"))
+	if err != nil {
+		t.Fatalf("ProposeAndWait after restart: %v", err)
+	}
+	if entry.Slot != 5 {
+		t.Errorf("decided slot %d after restart, want 5", entry.Slot)
+	}
+}
+
+func TestNodePipelinedCommitsInOrder(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, func(int) []Option {
+		return []Option{WithPipelineWindow(4)}
+	})
+	waitForLeader(t, nodes, 3)
+
+	ctx := context.Background()
+	const count = 20
+	for i := 0; i < count; i++ {
+		if err := nodes[3].Propose(ctx, []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("Propose(v%d) failed: %v", i, err)
+		}
+	}
+
+	for _, id := range []int{1, 3} {
+		for slot := 0; slot < count; slot++ {
+			select {
+			case entry := <-nodes[id].Committed():
+				if entry.Slot != slot {
+					t.Fatalf("node %d: committed slot %d, want slot %d next", id, entry.Slot, slot)
+				}
+				if want := fmt.Sprintf("v%d", slot); string(entry.Value) != want {
+					t.Errorf("node %d slot %d: got %q, want %q", id, slot, entry.Value, want)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("node %d: timed out waiting for slot %d", id, slot)
+			}
+		}
+	}
+}
+
+func TestNodeBatchesValues(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, func(int) []Option {
+		return []Option{WithBatching(50*time.Millisecond, 0, 4)}
+	})
+	waitForLeader(t, nodes, 3)
+
+	ctx := context.Background()
+	const count = 8
+	for i := 0; i < count; i++ {
+		if err := nodes[3].Propose(ctx, []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("Propose(v%d) failed: %v", i, err)
+		}
+	}
+
+	slots := make(map[int]bool)
+	for i := 0; i < count; i++ {
+		select {
+		case entry := <-nodes[1].Committed():
+			if want := fmt.Sprintf("v%d", i); string(entry.Value) != want {
+				t.Errorf("entry %d = %q, want %q", i, entry.Value, want)
+			}
+			slots[entry.Slot] = true
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out after %d entries", i)
+		}
+	}
+	if len(slots) >= count {
+		t.Errorf("%d values used %d slots, want them batched", count, len(slots))
+	}
+
+	entry, err := nodes[3].ProposeAndWait(ctx, []byte("waited"))
+	if err != nil {
+		t.Fatalf("ProposeAndWait: %v", err)
+	}
+	if string(entry.Value) != "waited" || entry.Index != 0 {
+		t.Errorf("ProposeAndWait = %+v, want %q at index 0", entry, "waited")
+	}
+}
+
+// lossyTransport drops the Accept messages it receives while drop is set,
+// as a partitioned learner would miss them.
+type lossyTransport struct {
+	Transport
+	drop atomic.Bool
+}
+
+func (t *lossyTransport) Receive(ctx context.Context) (Message, error) {
+	for {
+		msg, err := t.Transport.Receive(ctx)
+		if err != nil || !t.drop.Load() || msg.Type != AcceptMsg {
+			return msg, err
+		}
+	}
+}
+
+func TestNodeCatchesUpMissedSlots(t *testing.T) {
+	ids := []int{1, 2, 3}
+	transports := NewChannelTransportGroup(ids...)
+	lossy := &lossyTransport{Transport: transports[1]}
+	lossy.drop.Store(true)
+	transports[1] = lossy
+
+	nodes := make(map[int]*Node)
+	for _, id := range ids {
+		var peerIDs []int
+		for _, pid := range ids {
+			if pid != id {
+				peerIDs = append(peerIDs, pid)
+			}
+		}
+		nodes[id] = NewNode(id, peerIDs, transports[id])
+		nodes[id].Start(context.Background())
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+	})
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, v := range []string{"alpha", "beta", "gamma"} {
+		if _, err := nodes[3].ProposeAndWait(ctx, []byte(v)); err != nil {
+			t.Fatalf("ProposeAndWait(%q): %v", v, err)
+		}
+	}
+	select {
+	case entry := <-nodes[1].Committed():
+		t.Fatalf("node 1 committed %+v while missing every Accept", entry)
+	default:
+	}
+
+	// Once node 1 hears of a later slot, it fetches the ones it missed.
+	lossy.drop.Store(false)
+	if _, err := nodes[3].ProposeAndWait(ctx, []byte("delta")); err != nil {
+		t.Fatalf("ProposeAndWait(delta): %v", err)
+	}
+	for slot, want := range []string{"alpha", "beta", "gamma", "delta"} {
+		select {
+		case entry := <-nodes[1].Committed():
+			if entry.Slot != slot || string(entry.Value) != want {
+				t.Errorf("node 1 committed slot %d %q, want slot %d %q", entry.Slot, entry.Value, slot, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("node 1 did not catch up on slot %d", slot)
+		}
+	}
+}
+
+// committedSlots returns the slots of the entries waiting on n.Committed().
+func committedSlots(n *Node) []int {
+	var slots []int
+	for {
+		select {
+		case entry := <-n.Committed():
+			slots = append(slots, entry.Slot)
+		default:
+			return slots
+		}
+	}
+}
+
+func TestNodeHoldsBackOutOfOrderSlots(t *testing.T) {
+	n := NewNode(1, nil, NewChannelTransportGroup(1)[1])
+	n.learn(2, "gamma")
+	n.learn(1, "beta")
+	if slots := committedSlots(n); len(slots) != 0 {
+		t.Fatalf("committed %v before slot 0 was decided", slots)
+	}
+	n.learn(0, "alpha")
+	if slots := committedSlots(n); fmt.Sprint(slots) != "[0 1 2]" {
+		t.Errorf("committed slots %v, want [0 1 2]", slots)
+	}
+}
+
+func TestNodeUnorderedDelivery(t *testing.T) {
+	n := NewNode(1, nil, NewChannelTransportGroup(1)[1], WithUnorderedDelivery())
+	n.learn(2, "gamma")
+	n.learn(0, "alpha")
+	n.learn(1, "beta")
+	if slots := committedSlots(n); fmt.Sprint(slots) != "[2 0 1]" {
+		t.Errorf("committed slots %v, want them as decided: [2 0 1]", slots)
+	}
+}
+
+func TestNodeInstallsSnapshotWhenFarBehind(t *testing.T) {
+	ids := []int{1, 2, 3}
+	transports := NewChannelTransportGroup(ids...)
+	lossy := &lossyTransport{Transport: transports[1]}
+	lossy.drop.Store(true)
+	transports[1] = lossy
+
+	replicas := make(map[int]*Replica)
+	machines := make(map[int]*counter)
+	for _, id := range ids {
+		var peerIDs []int
+		for _, pid := range ids {
+			if pid != id {
+				peerIDs = append(peerIDs, pid)
+			}
+		}
+		machines[id] = &counter{}
+		node := NewNode(id, peerIDs, transports[id], WithSnapshots(4, nil))
+		replicas[id] = NewReplica(node, machines[id])
+		replicas[id].Start(context.Background())
+	}
+	t.Cleanup(func() {
+		for _, r := range replicas {
+			r.Stop()
+		}
+	})
+	nodes := make(map[int]*Node)
+	for id, r := range replicas {
+		nodes[id] = r.node
+	}
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	for i := 1; i <= 10; i++ {
+		if _, err := replicas[3].Propose(ctx, []byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Propose(%d): %v", i, err)
+		}
+	}
+	snap, ok := replicas[3].node.learner.storage.Snapshot()
+	if !ok {
+		t.Fatal("leader took no snapshot after 10 slots")
+	}
+	if _, ok := replicas[3].node.learner.storage.Decided(0); ok {
+		t.Errorf("leader kept slot 0 after compacting through slot %d", snap.Slot)
+	}
+
+	// Node 1 missed every slot, and the early ones are gone from its
+	// peers' logs, so it can only catch up through a snapshot.
+	lossy.drop.Store(false)
+	if _, err := replicas[3].Propose(ctx, []byte("11")); err != nil {
+		t.Fatalf("Propose(11): %v", err)
+	}
+	for {
+		if total, _ := machines[1].state(); total == 66 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			total, _ := machines[1].state()
+			t.Fatalf("node 1 reached total %d, want 66", total)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if _, applied := machines[1].state(); applied >= 11 {
+		t.Errorf("node 1 applied all %d commands one by one instead of installing a snapshot", applied)
+	}
+}
+
+func TestNodeRestartsOnCompactedStorage(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, func(int) []Option {
+		storage := NewMemoryStorage()
+		storage.SetSnapshot(Snapshot{Slot: 5})
+		return []Option{WithStorage(storage)}
+	})
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	entry, err := nodes[3].ProposeAndWait(ctx, []byte("x"))
+	if err != nil {
+		t.Fatalf("ProposeAndWait after restart: %v", err)
+	}
+	if entry.Slot != 6 {
+		t.Errorf("decided slot %d after restart, want 6 past the snapshot", entry.Slot)
+	}
+}
+
+func TestNodeDropsSlotsCoveredBySnapshot(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.SetSnapshot(Snapshot{Slot: 5})
+	transports := NewChannelTransportGroup(1, 2)
+	n := NewNode(1, []int{2}, transports[1], WithStorage(storage))
+	defer n.Stop()
+
+	// A proposal left in a slot the snapshot covers, which the acceptors
+	// answer with the snapshot the learner already has.
+	n.proposer.start(2, proposal{value: "stale"}, n.clock.Now())
+	n.installSnapshot(snapshotMessage(2, 1, Snapshot{Slot: 5}))
+	n.proposerTick()
+
+	if _, ok := n.proposer.instances[2]; ok {
+		t.Error("slot 2 is still in flight under a snapshot through slot 5")
+	}
+	if inst, ok := n.proposer.instances[6]; !ok || inst.prop.value != "stale" {
+		t.Errorf("slot 6 = %+v, want the value proposed again past the snapshot", inst)
+	}
+}
+
+func TestNodeReplacesDeadMember(t *testing.T) {
+	transports := NewChannelTransportGroup(1, 2, 3, 4)
+	nodes := make(map[int]*Node)
+	for _, id := range []int{2, 3, 4} {
+		var peerIDs []int
+		for _, pid := range []int{2, 3, 4} {
+			if pid != id {
+				peerIDs = append(peerIDs, pid)
+			}
+		}
+		nodes[id] = NewNode(id, peerIDs, transports[id])
+		nodes[id].Start(context.Background())
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+	})
+	waitForLeader(t, nodes, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	// Node 2 dies; node 1 takes its place.
+	nodes[2].Stop()
+	if err := nodes[4].RemoveMember(ctx, 2); err != nil {
+		t.Fatalf("RemoveMember(2): %v", err)
+	}
+	if err := nodes[4].AddMember(ctx, 1); err != nil {
+		t.Fatalf("AddMember(1): %v", err)
+	}
+	if err := nodes[4].AddMember(ctx, 4); !errors.Is(err, ErrMembership) {
+		t.Errorf("AddMember of an existing member: err = %v, want %v", err, ErrMembership)
+	}
+	nodes[1] = NewNode(1, []int{3, 4}, transports[1])
+	nodes[1].Start(context.Background())
+
+	// Run the changes into effect.
+	for i := 0; i < configDelay; i++ {
+		if _, err := nodes[4].ProposeAndWait(ctx, []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("ProposeAndWait(v%d): %v", i, err)
+		}
+	}
+	if got := fmt.Sprint(nodes[4].Members()); got != "[1 3 4]" {
+		t.Fatalf("members = %s, want [1 3 4]", got)
+	}
+
+	// With 2 and 3 both gone, only the new quorum {1, 4} can decide.
+	nodes[3].Stop()
+	entry, err := nodes[4].ProposeAndWait(ctx, []byte("after"))
+	if err != nil {
+		t.Fatalf("ProposeAndWait after replacement: %v", err)
+	}
+	for {
+		select {
+		case e := <-nodes[1].Committed():
+			if e.Slot == entry.Slot {
+				if string(e.Value) != "after" {
+					t.Errorf("node 1 committed %q in slot %d, want %q", e.Value, e.Slot, "after")
+				}
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("new member never committed the value decided by the new quorum")
+		}
+	}
+}
+
+func TestNodeLearnerOnlyFollowsLog(t *testing.T) {
+	transports := NewChannelTransportGroup(1, 2, 3, 4)
+	nodes := make(map[int]*Node)
+	for _, id := range []int{1, 2, 3} {
+		var peerIDs []int
+		for _, pid := range []int{1, 2, 3} {
+			if pid != id {
+				peerIDs = append(peerIDs, pid)
+			}
+		}
+		nodes[id] = NewNode(id, peerIDs, transports[id])
+	}
+	learner := NewNode(4, []int{1, 2, 3}, transports[4], WithLearnerOnly())
+	nodes[4] = learner
+	for _, node := range nodes {
+		node.Start(context.Background())
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+	})
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := nodes[3].AddLearner(ctx, 4); err != nil {
+		t.Fatalf("AddLearner(4): %v", err)
+	}
+	entry, err := nodes[3].ProposeAndWait(ctx, []byte("read me"))
+	if err != nil {
+		t.Fatalf("ProposeAndWait: %v", err)
+	}
+	for got := false; !got; {
+		select {
+		case e := <-learner.Committed():
+			got = e.Slot == entry.Slot && string(e.Value) == "read me"
+		case <-ctx.Done():
+			t.Fatal("learner-only node never committed the value")
+		}
+	}
+	// Heartbeats reach the learner too, so it can tell when it falls behind.
+	for learner.peersDecided.Load() <= int64(entry.Slot) {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("learner-only node never heard how far the log is decided")
+		}
+	}
+
+	if err := learner.Propose(ctx, []byte("write")); !errors.Is(err, ErrLearnerOnly) {
+		t.Errorf("Propose on a learner-only node: err = %v, want %v", err, ErrLearnerOnly)
+	}
+	if got := fmt.Sprint(nodes[3].Members(), nodes[3].Learners()); got != "[1 2 3] [4]" {
+		t.Errorf("members and learners = %s, want [1 2 3] [4]", got)
+	}
+}
+
+func TestNodeReportsMalformedMessages(t *testing.T) {
+	transports := NewChannelTransportGroup(1, 2)
+	node := NewNode(1, []int{2}, transports[1])
+	node.Start(context.Background())
+	defer node.Stop()
+
+	transports[2].Send(Message{From: 2, To: 1, Type: PrepareMsg, Ballot: Ballot{1, 2}, Slot: -3})
+	select {
+	case err := <-node.Errors():
+		if !errors.Is(err, ErrMalformedMessage) {
+			t.Errorf("error = %v, want %v", err, ErrMalformedMessage)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no error reported for a prepare for slot -3")
+	}
+	if got := node.Rejected(); got != 1 {
+		t.Errorf("Rejected() = %d, want 1", got)
+	}
+}
+
+func TestNodeReportsUnknownMessageType(t *testing.T) {
+	transports := NewChannelTransportGroup(1, 2)
+	node := NewNode(1, []int{2}, transports[1])
+	node.Start(context.Background())
+	defer node.Stop()
+
+	transports[2].Send(Message{From: 2, To: 1, Type: MessageType(42)})
+	select {
+	case err := <-node.Errors():
+		if !errors.Is(err, ErrUnsupportedMessage) {
+			t.Errorf("error = %v, want %v", err, ErrUnsupportedMessage)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no error reported for a message of type 42")
+	}
+	if got := node.Rejected(); got != 1 {
+		t.Errorf("Rejected() = %d, want 1", got)
+	}
+}
+
+// logBuffer collects log output written from several goroutines.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestNodeLogging(t *testing.T) {
+	// Nothing reaches the default logger unless a Node is given one.
+	var global logBuffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&global, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	var logs logBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	nodes := startTestCluster(t, []int{1, 2}, func(id int) []Option {
+		if id == 2 {
+			return []Option{WithLogger(logger)}
+		}
+		return nil
+	})
+	waitForLeader(t, nodes, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := nodes[2].ProposeAndWait(ctx, []byte("logged")); err != nil {
+		t.Fatalf("ProposeAndWait: %v", err)
+	}
+	if got := global.String(); got != "" {
+		t.Errorf("a Node without a logger logged to the default logger:\n%s", got)
+	}
+	out := logs.String()
+	for _, want := range []string{`"Proposer received message" "Proposer ID"=2`, `"Acceptor received message" "Acceptor ID"=2`, "level=DEBUG"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output lacks %s", want)
+		}
+	}
+	if strings.Contains(out, `"Proposer ID"=1`) {
+		t.Error("node 1, which has no logger, logged to node 2's")
+	}
+}
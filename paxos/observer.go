@@ -0,0 +1,68 @@
+package paxos
+
+import "fmt"
+
+// EventType identifies a protocol event reported to an Observer.
+type EventType int
+
+const (
+	PromiseGranted  EventType = iota + 1 // an acceptor promised a prepare's ballot
+	PromiseRejected                      // an acceptor refused a prepare, having promised a higher ballot
+	ValueAccepted                        // an acceptor accepted a proposal
+	SlotChosen                           // a learner learned the value chosen for a slot
+	LeaderElected                        // a proposer became the leader
+	LeaderDeposed                        // a proposer stopped being the leader
+	RoundRetried                         // a proposer abandoned a round to run it again
+)
+
+var eventTypes = [...]string{
+	PromiseGranted:  "PromiseGranted",
+	PromiseRejected: "PromiseRejected",
+	ValueAccepted:   "ValueAccepted",
+	SlotChosen:      "SlotChosen",
+	LeaderElected:   "LeaderElected",
+	LeaderDeposed:   "LeaderDeposed",
+	RoundRetried:    "RoundRetried",
+}
+
+func (t EventType) String() string {
+	if t < PromiseGranted || int(t) >= len(eventTypes) {
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+	return eventTypes[t]
+}
+
+// Event is a protocol event on one node. Fields that do not apply to the
+// event's Type are left zero.
+type Event struct {
+	Type EventType
+	Node int // the node the event happened on
+	Slot int // the slot concerned; zero for leadership events
+
+	// Ballot is the ballot the event concerns: the prepare's for promises,
+	// the proposal's for accepted values, and the abandoned round's for
+	// retries.
+	Ballot Ballot
+	// Promised is set on PromiseRejected to the higher ballot the acceptor
+	// had already promised.
+	Promised Ballot
+	// Value is set on ValueAccepted and SlotChosen.
+	Value []byte
+	// Reason is set on RoundRetried to why the round was abandoned.
+	Reason string
+}
+
+// Observer receives a Node's protocol events, for dashboards, audit trails
+// and tests. Observe is called synchronously from the goroutine of the role
+// the event happened in, so it must be safe for concurrent use and should
+// return quickly: a slow Observer slows the protocol down.
+type Observer interface {
+	Observe(Event)
+}
+
+// notify reports e to o, if there is one.
+func notify(o Observer, e Event) {
+	if o != nil {
+		o.Observe(e)
+	}
+}
@@ -0,0 +1,94 @@
+package paxos
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventLog is an Observer that records every event.
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (l *eventLog) Observe(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+// find returns the first recorded event of type t on node.
+func (l *eventLog) find(t EventType, node int) (Event, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.events {
+		if e.Type == t && e.Node == node {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+func TestNodeObserver(t *testing.T) {
+	var events eventLog
+	nodes := startTestCluster(t, []int{1, 2, 3}, func(int) []Option {
+		return []Option{WithObserver(&events)}
+	})
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := nodes[3].ProposeAndWait(ctx, []byte("observed")); err != nil {
+		t.Fatalf("ProposeAndWait: %v", err)
+	}
+	// The proposer hears its value was chosen before its learner does.
+	select {
+	case <-nodes[3].Committed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("node 3 did not commit its value")
+	}
+
+	if _, ok := events.find(LeaderElected, 3); !ok {
+		t.Error("node 3 reported no LeaderElected")
+	}
+	if e, ok := events.find(PromiseGranted, 3); !ok || e.Ballot.NodeID != 3 {
+		t.Errorf("node 3's PromiseGranted = %+v, %v; want a promise of its own ballot", e, ok)
+	}
+	// A quorum accepted the value before it was chosen, though not
+	// necessarily node 3's own acceptor.
+	accepted := 0
+	for id := range nodes {
+		if e, ok := events.find(ValueAccepted, id); ok && string(e.Value) == "observed" {
+			accepted++
+		}
+	}
+	if accepted < 2 {
+		t.Errorf("%d nodes reported accepting %q, want a quorum of 2", accepted, "observed")
+	}
+	if e, ok := events.find(SlotChosen, 3); !ok || e.Slot != 0 || string(e.Value) != "observed" {
+		t.Errorf("node 3's SlotChosen = %+v, %v; want %q in slot 0", e, ok, "observed")
+	}
+}
+
+func TestObserverSeesRejectionsAndRetries(t *testing.T) {
+	var events eventLog
+	a, env := newTestAcceptor(1)
+	a.observer = &events
+	a.receivePreparedMessage(messageData{messageSender: 100, ballot: Ballot{2, 100}, messageCategory: PrepareMessage})
+	a.receivePreparedMessage(messageData{messageSender: 100, ballot: Ballot{1, 100}, messageCategory: PrepareMessage})
+	if e, ok := events.find(PromiseRejected, 1); !ok || e.Ballot != (Ballot{1, 100}) || e.Promised != (Ballot{2, 100}) {
+		t.Errorf("PromiseRejected = %+v, %v; want ballot 1.100 refused for 2.100", e, ok)
+	}
+
+	env = NewPaxosEnvironment(1, 2, 3, 100)
+	p := NewProposer(100, "", env.GetNodeNetwork(100), 1, 2, 3)
+	p.observer = &events
+	now := time.Now()
+	p.start(0, proposal{value: "v"}, now)
+	p.tick(now.Add(2 * roundTimeout))
+	if e, ok := events.find(RoundRetried, 100); !ok || e.Slot != 0 || e.Reason == "" {
+		t.Errorf("RoundRetried = %+v, %v; want slot 0 with a reason", e, ok)
+	}
+}
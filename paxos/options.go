@@ -0,0 +1,122 @@
+package paxos
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+// Option configures optional behaviour of a Node.
+type Option func(*nodeConfig)
+
+type nodeConfig struct {
+	storage     Storage
+	window      int
+	batch       *batcher
+	unordered   bool
+	learnerOnly bool
+
+	snapshotter   Snapshotter
+	snapshotEvery int
+
+	clock    Clock
+	rng      *rand.Rand
+	logger   *slog.Logger
+	observer Observer
+}
+
+// WithStorage keeps the Node's acceptor and learner state in s instead of
+// memory. Passing a WAL makes the Node durable across restarts.
+func WithStorage(s Storage) Option {
+	return func(c *nodeConfig) {
+		c.storage = s
+	}
+}
+
+// WithPipelineWindow lets the Node's proposer keep up to n slots in flight,
+// instead of waiting for each slot to be decided before starting the next.
+// Slots more than 16 past the first one still undecided wait regardless,
+// since a membership change could yet govern them.
+func WithPipelineWindow(n int) Option {
+	return func(c *nodeConfig) {
+		c.window = n
+	}
+}
+
+// WithBatching packs the values proposed within maxDelay into a single slot,
+// up to maxBytes of values or maxCount values, whichever comes first; a zero
+// limit is ignored. Committed still emits one Entry per value, with Index
+// giving its place in the slot. Every node in a cluster must agree on
+// whether batching is on.
+func WithBatching(maxDelay time.Duration, maxBytes, maxCount int) Option {
+	return func(c *nodeConfig) {
+		c.batch = &batcher{maxDelay: maxDelay, maxBytes: maxBytes, maxCount: maxCount}
+	}
+}
+
+// WithUnorderedDelivery makes Committed emit each slot as soon as this Node
+// learns it, without waiting for earlier slots. It suits consumers that do
+// not apply entries in order and would rather not wait on a slow slot.
+func WithUnorderedDelivery() Option {
+	return func(c *nodeConfig) {
+		c.unordered = true
+	}
+}
+
+// WithSnapshots has the Node take a snapshot from s every interval decided
+// slots and forget the slot state it covers, so long-running Nodes do not
+// grow without bound. A Node too far behind its peers to catch up from their
+// logs is sent a snapshot, which it installs through s. s may be nil if a
+// Replica drives the Node and its StateMachine implements
+// SnapshotStateMachine; the Replica takes and restores the snapshots then.
+func WithSnapshots(interval int, s Snapshotter) Option {
+	return func(c *nodeConfig) {
+		c.snapshotEvery = interval
+		c.snapshotter = s
+	}
+}
+
+// WithLearnerOnly makes the Node a learner-only member, such as a read
+// replica: it follows the decided log and serves Committed, but runs no
+// acceptor or proposer and never counts toward a quorum. peerIDs passed to
+// NewNode are the voting members, and one of them must add the Node with
+// AddLearner for it to be sent accepted values.
+func WithLearnerOnly() Option {
+	return func(c *nodeConfig) {
+		c.learnerOnly = true
+	}
+}
+
+// WithClock measures the Node's heartbeats, timeouts and backoff against c
+// instead of the wall clock. A started Node still waits in real time between
+// readings, so c should keep pace with it; a Simulation, which drives its
+// Nodes itself, is the exception.
+func WithClock(c Clock) Option {
+	return func(cfg *nodeConfig) {
+		cfg.clock = c
+	}
+}
+
+// WithRand draws the Node's random backoff from r, so that runs can be
+// repeated from a seed. r must not be shared with another running Node.
+func WithRand(r *rand.Rand) Option {
+	return func(c *nodeConfig) {
+		c.rng = r
+	}
+}
+
+// WithLogger makes the Node log to l, with the node's ID attached to every
+// record. Each message sent and received is logged at Debug level; leadership
+// changes at Info, and failures at Error. By default a Node logs nothing.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *nodeConfig) {
+		c.logger = l
+	}
+}
+
+// WithObserver reports the Node's protocol events to o.
+func WithObserver(o Observer) Option {
+	return func(c *nodeConfig) {
+		c.observer = o
+	}
+}
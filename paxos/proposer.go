@@ -1,63 +1,244 @@
 package paxos
 
 import (
-	"fmt"
 	"log/slog"
-	"math/rand"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const electionTimeout = 500 * time.Millisecond
 
+// heartbeatInterval is how often a Node tells its peers it is alive. A peer
+// not heard from for leaderTimeout is considered dead.
+const (
+	heartbeatInterval = 100 * time.Millisecond
+	leaderTimeout     = electionTimeout
+)
+
+// Proposer drives slots to a decision. Up to window slots are in flight at
+// once, each with its own instance; the leader's phase 1 promises are shared
+// between them.
 type Proposer struct {
-	id             int
-	seq            int
-	proposalNumber int
-	proposalValue  string
-	acceptors      map[int]messageData
-	node           nodeNetwork
-	peers          []int
-	isLeader       bool
-	slot           int
-	values         chan string
+	id            int
+	round         uint64 // highest round used or seen; the next phase 1 goes above it
+	ballot        Ballot // ballot of the most recent phase 1
+	proposalValue string // value proposed by Run
+	acceptors     []int
+	members       *membership // acceptors per slot
+	node          nodeNetwork
+	peersMu       sync.Mutex // guards peers, which heartbeats read from their own goroutine
+	peers         []int
+	isLeader      bool
+	clock         Clock
+	rng           *rand.Rand // draws the backoff between phase 1 attempts
+	logger        *slog.Logger
+	metrics       *metrics
+	observer      Observer
+	lastSeen      map[int]time.Time // peer ID -> last heartbeat
+	prepared      bool              // phase 1 won at ballot; new slots skip it
+	preparedWith  []int             // the members whose promises prepared holds
+	preparedAbove int               // prepared covers only later slots; up to it, a member may hold a value
+	preparing     *instance         // the instance that ran the latest phase 1, until it finishes
+	prepareAfter  time.Time         // backoff before the next phase 1
+	window        int               // maximum number of slots in flight
+	batch         *batcher          // nil unless values are batched
+	instances     map[int]*instance // slot -> in-flight instance
+	decided       *atomic.Int64     // one past the highest slot decided here, sent in heartbeats; nil outside a Node
+	values        chan proposal
+	done          chan struct{}
+}
+
+// roundTimeout is how long a phase may wait for replies before the slot is
+// prepared again.
+const roundTimeout = time.Second
+
+// phase is the step an instance is waiting on.
+type phase int
+
+const (
+	phaseWaiting phase = iota // for phase 1 to be allowed, or for the leader's promises
+	phasePrepare              // for promises
+	phasePropose              // for accepts
+)
+
+// instance is the proposer's state for one slot in flight.
+type instance struct {
+	slot          int
+	prop          proposal
+	ballot        Ballot
+	proposalValue string              // prop.value, or the value adopted under P2c
+	adopted       bool                // proposalValue came from another proposer's accept
+	proposed      map[Ballot]bool     // ballots phase 2 ran under -> whether its value was adopted
+	members       []int               // acceptors for the slot; nil until known
+	acceptors     map[int]messageData // acceptor ID -> promise for the current round
+	accepts       map[int]bool        // acceptors that accepted the current proposal
+	phase         phase
+	needsPrepare  bool      // the slot must run phase 1 itself before proposing
+	deadline      time.Time // when the current phase gives up
+	started       time.Time // when the slot was put in flight
+	rounds        int       // phase 1 or steady-state phase 2 attempts so far
+}
+
+// proposal is a value waiting for a slot. If done is set, it receives the
+// outcome of the slot the proposal ran in. A batch packs the values of
+// several proposals into one, and answers each of them.
+type proposal struct {
+	value string
+	done  chan outcome
+	batch []proposal
+}
+
+// outcome tells a proposal's submitter how its slot was decided. Whether
+// the proposal won is decided once for the slot's whole value, not from the
+// bytes of the entry handed back, which for a lost batch is just the
+// winner's first value.
+type outcome struct {
+	entry  Entry // the proposal's own value, or else the one that won the slot
+	chosen bool
+}
+
+// report tells the submitters of a decided instance which value won its slot.
+// The proposal won unless phase 1 made the instance adopt a value another
+// proposer had put in the slot, even one with the same bytes.
+func (p *Proposer) report(inst *instance) {
+	won := !inst.adopted
+	if inst.prop.batch == nil {
+		if inst.prop.done != nil {
+			inst.prop.done <- outcome{entry: Entry{Slot: inst.slot, Value: []byte(inst.proposalValue)}, chosen: won}
+		}
+		return
+	}
+	winner := unbatch(inst.slot, inst.proposalValue)[0]
+	for i, member := range inst.prop.batch {
+		if member.done == nil {
+			continue
+		}
+		if won {
+			member.done <- outcome{entry: Entry{Slot: inst.slot, Index: i, Value: []byte(member.value)}, chosen: true}
+		} else {
+			member.done <- outcome{entry: winner}
+		}
+	}
 }
 
 func NewProposer(id int, value string, node nodeNetwork, acceptors ...int) *Proposer{
 	newProposer := Proposer{
 		id: id,
-		seq: 0,
 		proposalValue: value,
+		acceptors: acceptors,
+		members: newMembership(acceptors),
 		node: node,
-		values: make(chan string, 64),
-	}
-	newProposer.acceptors = make(map[int]messageData, len(acceptors))
-	for _, acceptor := range acceptors {
-		newProposer.acceptors[acceptor] = messageData{}
+		clock: realClock{},
+		rng: newRand(),
+		logger: discardLogger,
+		metrics: newMetrics(),
+		lastSeen: make(map[int]time.Time),
+		window: 1,
+		instances: make(map[int]*instance),
+		values: make(chan proposal, 64),
+		done: make(chan struct{}),
 	}
 	return &newProposer
 }
 
+// SetLogger makes the proposer log to l, with its ID attached. A nil l turns
+// logging off, which is the default.
+func (p *Proposer) SetLogger(l *slog.Logger) {
+	p.logger = orDiscard(l).With("Proposer ID", p.id)
+}
+
+// SetWindow lets up to n slots be in flight at once. The default is 1, which
+// decides one slot per round trip.
+func (p *Proposer) SetWindow(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.window = n
+}
+
+// SetBatching makes a Node's proposer pack the values queued within maxDelay
+// into one slot, up to maxBytes of values or maxCount values, whichever is
+// reached first. A limit of zero leaves that limit off.
+func (p *Proposer) SetBatching(maxDelay time.Duration, maxBytes, maxCount int) {
+	p.batch = &batcher{maxDelay: maxDelay, maxBytes: maxBytes, maxCount: maxCount}
+}
+
+// Stop makes a running slot give up at its next retry.
+func (p *Proposer) Stop() {
+	close(p.done)
+}
+
+func (p *Proposer) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *Proposer) majority() int {
-	return len(p.acceptors)/2 + 1
+	return len(p.members.latest())/2 + 1
 }
 
-const maxNodes = 10000
+// nextBallot moves to a new round and returns the proposer's ballot for it.
+func (p *Proposer) nextBallot() Ballot {
+	p.round++
+	p.ballot = Ballot{Round: p.round, NodeID: uint64(p.id)}
+	return p.ballot
+}
 
-func (p *Proposer) getProposerNumber() int {
-	p.proposalNumber = p.seq*maxNodes + p.id
-	return p.proposalNumber
+func (p *Proposer) newInstance(slot int, prop proposal) *instance {
+	inst := &instance{
+		slot:          slot,
+		prop:          prop,
+		proposalValue: prop.value,
+		acceptors:     make(map[int]messageData),
+		accepts:       make(map[int]bool),
+		proposed:      make(map[Ballot]bool),
+	}
+	p.resolveMembers(inst)
+	return inst
 }
 
-func (p *Proposer) getPromiseCount() int {
+// resolveMembers sets the instance's acceptors once the members for its slot
+// are known. It reports whether they are.
+func (p *Proposer) resolveMembers(inst *instance) bool {
+	if inst.members != nil {
+		return true
+	}
+	members, ok := p.members.at(inst.slot)
+	if !ok {
+		return false
+	}
+	inst.members = members
+	for _, acceptorID := range members {
+		inst.acceptors[acceptorID] = messageData{}
+	}
+	return true
+}
+
+// quorum returns how many of the instance's acceptors form a majority.
+func (inst *instance) quorum() int {
+	return len(inst.members)/2 + 1
+}
+
+func (p *Proposer) getPromiseCount(inst *instance) int {
 	promiseCount := 0
-	for _, message := range p.acceptors {
-		slog.Info("Proposer information",
-			"Proposer ID", p.id,
-			"Acceptor Count", len(p.acceptors),
-			"Current Proposal Number", p.proposalNumber,
-			"Message Sequence Number", message.getMessageNumber(),
+	for _, message := range inst.acceptors {
+		p.logger.Debug("Proposer information",
+			"Slot", inst.slot,
+			"Acceptor Count", len(inst.acceptors),
+			"Current Ballot", inst.ballot,
+			"Message Ballot", message.getBallot(),
 		)
-		if message.getMessageNumber() == p.proposalNumber {
+		// An ack reporting a previously accepted value carries that value's
+		// ballot, so the promised ballot is checked as well.
+		if message.getBallot() == inst.ballot || message.promised == inst.ballot {
 			promiseCount+=1
 		}
 	}
@@ -65,27 +246,38 @@ func (p *Proposer) getPromiseCount() int {
 }
 
 // consistency quorum
-func (p *Proposer) reachedMajority() bool {
-	return p.getPromiseCount() >= p.majority()
+func (p *Proposer) reachedMajority(inst *instance) bool {
+	return p.getPromiseCount(inst) >= inst.quorum()
+}
+
+// highestPromised returns the highest slot any acceptor that promised the
+// instance's ballot had accepted a value in when it promised.
+func (p *Proposer) highestPromised(inst *instance) int {
+	highest := -1
+	for _, message := range inst.acceptors {
+		if message.getBallot() == inst.ballot || message.promised == inst.ballot {
+			highest = max(highest, message.highestAccepted)
+		}
+	}
+	return highest
 }
 
 // send prepare message to all acceptors
-func (p *Proposer) prepare() []messageData {
-	p.seq+=1
-	p.getProposerNumber()
+func (p *Proposer) prepare(inst *instance) []messageData {
+	inst.ballot = p.nextBallot()
 	// Reset acceptor promise state for this new round
-	for acceptorID := range p.acceptors {
-		p.acceptors[acceptorID] = messageData{}
+	for acceptorID := range inst.acceptors {
+		inst.acceptors[acceptorID] = messageData{}
 	}
 	var messageList []messageData
-	for acceptorID := range p.acceptors {
+	for _, acceptorID := range inst.members {
 		message := messageData{
 			messageSender:    p.id,
 			messageRecipient: acceptorID,
 			messageCategory:  PrepareMessage,
-			messageNumber:    p.proposalNumber,
-			value:            p.proposalValue,
-			slot:             p.slot,
+			ballot:           inst.ballot,
+			value:            inst.proposalValue,
+			slot:             inst.slot,
 		}
 		messageList = append(messageList, message)
 	}
@@ -93,59 +285,110 @@ func (p *Proposer) prepare() []messageData {
 }
 
 // send propose message to acceptors that promised
-func (p *Proposer) propose() []messageData {
+func (p *Proposer) propose(inst *instance) []messageData {
 	var messageList []messageData
-	for acceptorID, acceptorMessage := range p.acceptors {
-		if acceptorMessage.getMessageNumber() > 0 {
-			message := messageData{
-				messageSender:    p.id,
-				messageRecipient: acceptorID,
-				messageCategory:  ProposeMessage,
-				messageNumber:    p.proposalNumber,
-				value:            p.proposalValue,
-				slot:             p.slot,
-			}
-			messageList = append(messageList, message)
+	for _, acceptorID := range inst.members {
+		if !inst.acceptors[acceptorID].getBallot().IsZero() {
+			messageList = append(messageList, p.proposeMessage(inst, acceptorID))
 		}
 	}
 	return messageList
 }
 
+// proposeSteady sends the instance's value to every acceptor without a fresh
+// phase 1, relying on the promises won for an earlier slot.
+func (p *Proposer) proposeSteady(inst *instance) []messageData {
+	var messageList []messageData
+	for _, acceptorID := range inst.members {
+		messageList = append(messageList, p.proposeMessage(inst, acceptorID))
+	}
+	return messageList
+}
+
+func (p *Proposer) proposeMessage(inst *instance, acceptorID int) messageData {
+	return messageData{
+		messageSender:    p.id,
+		messageRecipient: acceptorID,
+		messageCategory:  ProposeMessage,
+		ballot:           inst.ballot,
+		value:            inst.proposalValue,
+		slot:             inst.slot,
+	}
+}
+
 // receivePromise records a promise from an acceptor and adopts
 // the highest-numbered previously accepted value (P2c invariant).
-func (p *Proposer) receivePromise(promiseMessage messageData) {
-	_, known := p.acceptors[promiseMessage.messageSender]
+func (p *Proposer) receivePromise(inst *instance, promiseMessage messageData) {
+	_, known := inst.acceptors[promiseMessage.messageSender]
 	if !known {
 		return
 	}
-	p.acceptors[promiseMessage.messageSender] = promiseMessage
+	inst.acceptors[promiseMessage.messageSender] = promiseMessage
 
 	// P2c: if the acceptor reports a previously accepted value,
-	// adopt it if its proposal number is higher than any we've seen.
-	if promiseMessage.getMessageNumber() > 0 && promiseMessage.value != "" {
-		// Track highest accepted proposal number across all promises
-		highestNum := 0
-		highestVal := p.proposalValue
-		for _, msg := range p.acceptors {
-			if msg.getMessageNumber() > highestNum && msg.value != "" {
-				highestNum = msg.getMessageNumber()
+	// adopt it if its ballot is higher than any we've seen.
+	if !promiseMessage.getBallot().IsZero() && promiseMessage.value != "" {
+		// Track highest accepted ballot across all promises
+		var highest Ballot
+		highestVal, adopted := inst.proposalValue, inst.adopted
+		for _, msg := range inst.acceptors {
+			// An ack carrying our own ballot only echoes our prepare.
+			if msg.getBallot() == inst.ballot {
+				continue
+			}
+			if highest.Less(msg.getBallot()) && msg.value != "" {
+				highest = msg.getBallot()
 				highestVal = msg.value
+				// A value this instance proposed in an earlier round is
+				// only someone else's if it was adopted back then.
+				wasAdopted, own := inst.proposed[highest]
+				adopted = wasAdopted || !own
 			}
 		}
-		p.proposalValue = highestVal
+		inst.proposalValue, inst.adopted = highestVal, adopted
+	}
+}
+
+// receiveNack handles a rejection from an acceptor. It reports whether the
+// acceptor has promised a higher ballot than the instance's, in which case
+// the round cannot succeed; round is then advanced so the next prepare
+// outbids it. A ballot above our own latest phase 1 also means the leader's
+// promises are gone.
+func (p *Proposer) receiveNack(inst *instance, nackMessage messageData) bool {
+	if !inst.ballot.Less(nackMessage.getBallot()) {
+		return false
+	}
+	p.logger.Debug("Proposer rejected by acceptor",
+		"Acceptor ID", nackMessage.messageSender,
+		"Slot", inst.slot,
+		"Proposal Ballot", inst.ballot,
+		"Promised Ballot", nackMessage.getBallot(),
+	)
+	p.round = max(p.round, nackMessage.getBallot().Round)
+	if p.ballot.Less(nackMessage.getBallot()) {
+		p.prepared = false
 	}
+	return true
 }
 
 // SetPeers configures the other proposer IDs that participate in leader election.
 // When peers are set, electLeader runs before the Paxos protocol.
 // When no peers are set, election is skipped (backward compatible).
 func (p *Proposer) SetPeers(peers ...int) {
+	p.peersMu.Lock()
+	defer p.peersMu.Unlock()
 	p.peers = peers
 }
 
+func (p *Proposer) peerList() []int {
+	p.peersMu.Lock()
+	defer p.peersMu.Unlock()
+	return p.peers
+}
+
 // Submit enqueues a value for multi-decree consensus.
 func (p *Proposer) Submit(value string) {
-	p.values <- value
+	p.values <- proposal{value: value}
 }
 
 // Close signals that no more values will be submitted.
@@ -156,27 +399,25 @@ func (p *Proposer) Close() {
 // electLeader implements a simple highest-alive-ID-wins election.
 // Each proposer broadcasts a heartbeat to its peers and listens for
 // the duration of electionTimeout. If a heartbeat from a higher-ID
-// peer arrives, this proposer yields leadership.
+// peer arrives, this proposer yields leadership. The highest ID cannot
+// be outranked, so it leads without waiting out the window.
 func (p *Proposer) electLeader() {
-	if len(p.peers) == 0 {
+	peers := p.peerList()
+	if len(peers) == 0 {
 		p.isLeader = true
 		return
 	}
 
-	// Broadcast heartbeat to all peers.
-	for _, peerID := range p.peers {
-		p.node.send(messageData{
-			messageSender:    p.id,
-			messageRecipient: peerID,
-			messageCategory:  HeartbeatMessage,
-		})
-	}
+	p.sendHeartbeats()
 
 	// Listen for heartbeats until the election window closes.
 	p.isLeader = true
-	deadline := time.Now().Add(electionTimeout)
-	for {
-		remaining := time.Until(deadline)
+	deadline := p.clock.Now().Add(electionTimeout)
+	if slices.Max(peers) < p.id {
+		deadline = p.clock.Now()
+	}
+	for p.isLeader {
+		remaining := deadline.Sub(p.clock.Now())
 		if remaining <= 0 {
 			break
 		}
@@ -184,62 +425,322 @@ func (p *Proposer) electLeader() {
 		if msg == nil {
 			break
 		}
-		if msg.messageCategory == HeartbeatMessage && msg.messageSender > p.id {
-			p.isLeader = false
+		if msg.messageCategory == HeartbeatMessage {
+			p.recordHeartbeat(*msg)
+			if msg.messageSender > p.id {
+				p.isLeader = false
+			}
 		}
 	}
 
 	if p.isLeader {
-		slog.Info("Elected as leader", "Proposer ID", p.id)
+		p.metrics.leaderChanges.Add(1)
+		notify(p.observer, Event{Type: LeaderElected, Node: p.id})
+		p.logger.Info("Elected as leader")
+	} else {
+		p.logger.Info("Deferring to higher-ID leader")
+	}
+}
+
+// sendHeartbeats tells the peers, and the learners that follow them, that
+// this proposer is alive and how far its log is decided, so that a node that
+// missed the latest slots knows to catch up.
+func (p *Proposer) sendHeartbeats() {
+	var decided int
+	if p.decided != nil {
+		decided = int(p.decided.Load())
+	}
+	recipients := p.peerList()
+	if p.members != nil {
+		recipients = slices.Concat(recipients, p.members.latestLearners())
+	}
+	for _, peerID := range recipients {
+		p.node.send(messageData{
+			messageSender:    p.id,
+			messageRecipient: peerID,
+			messageCategory:  HeartbeatMessage,
+			slot:             decided,
+		})
+	}
+}
+
+func (p *Proposer) recordHeartbeat(msg messageData) {
+	p.lastSeen[msg.messageSender] = p.clock.Now()
+}
+
+// leader returns the highest ID among this proposer and the peers heard
+// from within leaderTimeout. A proposer removed from the membership does not
+// count itself, and no longer hears from the nodes that are not its peers.
+func (p *Proposer) leader() int {
+	leaderID := p.id
+	if p.members.dynamic && !p.members.contains(p.id) {
+		leaderID = -1
+	}
+	now := p.clock.Now()
+	for _, peerID := range p.peerList() {
+		seen, ok := p.lastSeen[peerID]
+		if ok && peerID > leaderID && now.Sub(seen) < leaderTimeout {
+			leaderID = peerID
+		}
+	}
+	return leaderID
+}
+
+// checkLeader re-runs the highest-alive-ID election against the heartbeats
+// seen so far. A follower whose leader has gone quiet takes over here.
+func (p *Proposer) checkLeader() {
+	isLeader := p.leader() == p.id
+	if isLeader == p.isLeader {
+		return
+	}
+	p.isLeader = isLeader
+	p.metrics.leaderChanges.Add(1)
+	if isLeader {
+		notify(p.observer, Event{Type: LeaderElected, Node: p.id})
+		p.logger.Info("Leader timed out, taking over")
 	} else {
-		slog.Info("Deferring to higher-ID leader", "Proposer ID", p.id)
+		notify(p.observer, Event{Type: LeaderDeposed, Node: p.id})
+		p.logger.Info("Deferring to higher-ID leader", "Leader ID", p.leader())
 	}
 }
 
-func (p *Proposer) runSlot(slot int, value string) {
-	p.slot = slot
-	p.proposalValue = value
-	p.seq = 0
+// start puts prop in flight in slot.
+func (p *Proposer) start(slot int, prop proposal, now time.Time) {
+	inst := p.newInstance(slot, prop)
+	inst.started = now
+	p.instances[slot] = inst
+	p.advance(inst, now)
+}
 
-	for {
-		// Phase 1a: send prepare messages
-		messageList := p.prepare()
-		for _, message := range messageList {
-			p.node.send(message)
+// fill puts a no-op in flight in slot, a hole below the slots decided. The
+// slot may hold a value this proposer never saw, so it runs its own phase 1.
+func (p *Proposer) fill(slot int, now time.Time) {
+	inst := p.newInstance(slot, proposal{value: noopValue})
+	inst.started = now
+	inst.needsPrepare = true
+	p.instances[slot] = inst
+	p.advance(inst, now)
+}
+
+// advance moves a waiting instance on. Multi-Paxos steady state: while the
+// leader's promises hold, a slot goes straight to phase 2. Otherwise it runs
+// phase 1, but only one instance at a time, so that concurrent rounds from
+// this proposer do not outbid each other.
+func (p *Proposer) advance(inst *instance, now time.Time) {
+	if inst.phase != phaseWaiting || !p.resolveMembers(inst) {
+		return
+	}
+	// Promises won from one set of members say nothing about another's.
+	// Nor do they cover slots where a member may already hold a value, which
+	// only that slot's own phase 1 would learn of.
+	if p.prepared && !inst.needsPrepare && inst.slot > p.preparedAbove &&
+		slices.Equal(inst.members, p.preparedWith) {
+		inst.ballot = p.ballot
+		inst.rounds++
+		p.startPhase2(inst, p.proposeSteady(inst), now)
+		return
+	}
+	if p.preparing != nil || now.Before(p.prepareAfter) {
+		return
+	}
+	p.preparing = inst
+	p.prepared = false
+	inst.rounds++
+	inst.phase = phasePrepare
+	inst.deadline = now.Add(roundTimeout)
+	// Phase 1a: send prepare messages
+	for _, message := range p.prepare(inst) {
+		p.node.send(message)
+	}
+}
+
+// slots returns the slots in flight, lowest first.
+func (p *Proposer) slots() []int {
+	slots := make([]int, 0, len(p.instances))
+	for slot := range p.instances {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+	return slots
+}
+
+// advanceAll advances every waiting instance, lowest slot first.
+func (p *Proposer) advanceAll(now time.Time) {
+	for _, slot := range p.slots() {
+		if inst, ok := p.instances[slot]; ok {
+			p.advance(inst, now)
 		}
+	}
+}
 
-		// Phase 1b: collect promises until majority or timeout
-		for !p.reachedMajority() {
-			msg := p.node.receive()
-			if msg == nil {
-				// Timeout — no more messages, re-prepare with higher number
-				break
+func (p *Proposer) startPhase2(inst *instance, messageList []messageData, now time.Time) {
+	inst.phase = phasePropose
+	inst.accepts = make(map[int]bool, len(p.acceptors))
+	inst.proposed[inst.ballot] = inst.adopted
+	inst.deadline = now.Add(roundTimeout)
+	for _, message := range messageList {
+		p.node.send(message)
+	}
+}
+
+// retry abandons the instance's current round. It runs again once advanced,
+// after a backoff if the leader has lost its promises.
+func (p *Proposer) retry(inst *instance, now time.Time, reason string) {
+	p.logger.Debug(reason,
+		"Slot", inst.slot,
+		"Proposal Ballot", inst.ballot,
+	)
+	p.metrics.retries.Add(1)
+	notify(p.observer, Event{Type: RoundRetried, Node: p.id, Slot: inst.slot, Ballot: inst.ballot, Reason: reason})
+	inst.phase = phaseWaiting
+	if p.preparing == inst {
+		p.preparing = nil
+	}
+	if !p.prepared {
+		p.metrics.backoffs.Add(1)
+		// Random backoff to reduce livelock probability with competing proposers
+		p.prepareAfter = now.Add(time.Duration(p.rng.IntN(150)+50) * time.Millisecond)
+	}
+	p.advanceAll(now)
+}
+
+// handle feeds a reply to the instance for its slot. It returns that
+// instance if the reply got its value chosen.
+func (p *Proposer) handle(msg messageData, now time.Time) *instance {
+	if msg.messageCategory == HeartbeatMessage {
+		p.recordHeartbeat(msg)
+		return nil
+	}
+	inst, ok := p.instances[msg.slot]
+	if !ok {
+		// A late reply for a slot that is already decided.
+		return nil
+	}
+	switch msg.messageCategory {
+	case AckMessage:
+		if inst.phase != phasePrepare {
+			return nil
+		}
+		p.logger.Debug("Ack message received", "Acceptor ID", msg.messageSender)
+		p.receivePromise(inst, msg)
+		if p.reachedMajority(inst) {
+			// The promises cover every later slot too, until a higher ballot wins.
+			p.prepared = inst.ballot == p.ballot
+			p.preparedWith = inst.members
+			p.preparedAbove = p.highestPromised(inst)
+			inst.needsPrepare = false
+			// Phase 2a: send propose messages to acceptors that promised
+			p.startPhase2(inst, p.propose(inst), now)
+			p.advanceAll(now)
+		}
+	case AcceptedMessage:
+		if inst.phase != phasePropose {
+			return nil
+		}
+		_, known := inst.acceptors[msg.messageSender]
+		if known && msg.getBallot() == inst.ballot {
+			inst.accepts[msg.messageSender] = true
+		}
+		if len(inst.accepts) >= inst.quorum() {
+			p.metrics.rounds.observe(float64(inst.rounds))
+			p.metrics.commitLatency.observe(now.Sub(inst.started).Seconds())
+			delete(p.instances, inst.slot)
+			if p.preparing == inst {
+				p.preparing = nil
 			}
-			msg.printMessage("Proposer received message")
-			if msg.messageCategory == AckMessage && msg.slot == p.slot {
-				slog.Info(fmt.Sprintf("Ack message received from %d", msg.messageSender))
-				p.receivePromise(*msg)
+			p.advanceAll(now)
+			return inst
+		}
+	case NackMessage:
+		p.metrics.nacksReceived.Add(1)
+		switch {
+		case inst.phase == phasePrepare && p.receiveNack(inst, msg):
+			p.retry(inst, now, "Proposer did not reach majority, retrying")
+		case inst.phase == phasePropose && !msg.getBallot().Less(inst.ballot):
+			if !p.receiveNack(inst, msg) {
+				// An equal ballot means the acceptor wants this slot prepared first.
+				inst.needsPrepare = true
 			}
+			p.retry(inst, now, "Proposal was not accepted by a majority, retrying")
 		}
+	}
+	return nil
+}
 
-		if p.reachedMajority() {
-			break
+// forget drops the instances for slots up to through, which a snapshot from
+// a peer has covered, and returns them so their values can be proposed again.
+func (p *Proposer) forget(through int) []*instance {
+	var forgotten []*instance
+	for _, slot := range p.slots() {
+		if slot > through {
+			continue
+		}
+		inst := p.instances[slot]
+		delete(p.instances, slot)
+		if p.preparing == inst {
+			p.preparing = nil
+		}
+		forgotten = append(forgotten, inst)
+	}
+	return forgotten
+}
+
+// tick gives up phases whose replies are overdue, and starts phase 1 for
+// instances whose backoff has passed.
+func (p *Proposer) tick(now time.Time) {
+	for _, slot := range p.slots() {
+		inst, ok := p.instances[slot]
+		if ok && inst.phase != phaseWaiting && now.After(inst.deadline) {
+			// Replies were lost or the acceptors follow someone else now.
+			p.prepared = false
+			p.retry(inst, now, "Proposer timed out, retrying")
 		}
-		// Did not reach majority — loop will re-prepare with higher seq
-		slog.Info("Proposer did not reach majority, retrying",
-			"Proposer ID", p.id,
-			"Proposal Number", p.proposalNumber,
-		)
-		// Random backoff to reduce livelock probability with competing proposers
-		backoff := time.Duration(rand.Intn(150)+50) * time.Millisecond
-		time.Sleep(backoff)
 	}
+	p.advanceAll(now)
+}
 
-	// Phase 2a: send propose messages to acceptors that promised
-	proposerMessageList := p.propose()
-	for _, message := range proposerMessageList {
-		p.node.send(message)
+// untilNext returns how long the proposer can wait for a reply before tick
+// has work to do.
+func (p *Proposer) untilNext(now time.Time) time.Duration {
+	wait := roundTimeout
+	for _, inst := range p.instances {
+		switch {
+		case inst.phase != phaseWaiting:
+			wait = min(wait, inst.deadline.Sub(now))
+		case p.preparing == nil:
+			wait = min(wait, p.prepareAfter.Sub(now))
+		}
 	}
+	return max(wait, time.Millisecond)
+}
+
+// poll waits for one reply, or until tick has work to do. It returns the
+// instance the reply decided, if any.
+func (p *Proposer) poll() *instance {
+	msg := p.node.receiveWithTimeout(p.untilNext(p.clock.Now()))
+	now := p.clock.Now()
+	var decided *instance
+	if msg != nil {
+		msg.printMessage(p.logger, "Proposer received message")
+		decided = p.handle(*msg, now)
+	}
+	p.tick(now)
+	return decided
+}
+
+// runSlot drives one Paxos instance until a value is chosen for slot and
+// returns that value. It differs from value when the slot already held a
+// value that had to be adopted (P2c). It returns false if the proposer is
+// stopped before the slot is decided.
+func (p *Proposer) runSlot(slot int, value string) (string, bool) {
+	p.start(slot, proposal{value: value}, p.clock.Now())
+	for !p.stopped() {
+		if inst := p.poll(); inst != nil && inst.slot == slot {
+			return inst.proposalValue, true
+		}
+	}
+	delete(p.instances, slot)
+	return "", false
 }
 
 func (p *Proposer) Run() {
@@ -250,15 +751,41 @@ func (p *Proposer) Run() {
 	p.runSlot(0, p.proposalValue)
 }
 
-// RunMulti drives consensus across multiple slots, one per submitted value.
+// RunMulti drives consensus across multiple slots, one per submitted value,
+// with up to the window's worth of slots in flight.
 func (p *Proposer) RunMulti() {
 	p.electLeader()
 	if !p.isLeader {
 		return
 	}
 	slot := 0
-	for value := range p.values {
-		p.runSlot(slot, value)
-		slot++
+	values := p.values
+	for !p.stopped() && (values != nil || len(p.instances) > 0) {
+	fill:
+		for values != nil && len(p.instances) < p.window {
+			var prop proposal
+			var ok bool
+			if len(p.instances) == 0 {
+				prop, ok = <-values
+			} else {
+				select {
+				case prop, ok = <-values:
+				default:
+					break fill
+				}
+			}
+			if !ok {
+				values = nil
+				break
+			}
+			p.start(slot, prop, p.clock.Now())
+			slot++
+		}
+		if len(p.instances) == 0 {
+			continue
+		}
+		if inst := p.poll(); inst != nil {
+			p.report(inst)
+		}
 	}
 }
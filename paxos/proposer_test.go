@@ -3,27 +3,28 @@ package paxos
 import (
 	"fmt"
 	"log/slog"
+	"math"
+	"sync"
 	"testing"
 	"time"
 )
 
-func TestProposalNumberMonotonicity(t *testing.T) {
+func TestBallotMonotonicity(t *testing.T) {
 	env := NewPaxosEnvironment(1, 2, 3, 100)
 	node := env.GetNodeNetwork(100)
 	p := NewProposer(100, "test", node, 1, 2, 3)
 
-	prev := 0
+	var prev Ballot
 	for i := 0; i < 100; i++ {
-		p.seq++
-		num := p.getProposerNumber()
-		if num <= prev {
-			t.Errorf("Proposal number not monotonically increasing: seq=%d produced %d, previous was %d", p.seq, num, prev)
+		ballot := p.nextBallot()
+		if !prev.Less(ballot) {
+			t.Errorf("Ballot not monotonically increasing: round=%d produced %v, previous was %v", p.round, ballot, prev)
 		}
-		prev = num
+		prev = ballot
 	}
 }
 
-func TestProposalNumberUniqueness(t *testing.T) {
+func TestBallotUniqueness(t *testing.T) {
 	env := NewPaxosEnvironment(1, 2, 3, 100, 101, 200)
 
 	node1 := env.GetNodeNetwork(100)
@@ -34,33 +35,49 @@ func TestProposalNumberUniqueness(t *testing.T) {
 	p2 := NewProposer(101, "val2", node2, 1, 2, 3)
 	p3 := NewProposer(200, "val3", node3, 1, 2, 3)
 
-	seen := make(map[int]bool)
+	seen := make(map[Ballot]bool)
 	proposers := []*Proposer{p1, p2, p3}
 	for _, p := range proposers {
 		for i := 0; i < 50; i++ {
-			p.seq++
-			num := p.getProposerNumber()
-			if seen[num] {
-				t.Errorf("Duplicate proposal number %d from proposer %d at seq %d", num, p.id, p.seq)
+			ballot := p.nextBallot()
+			if seen[ballot] {
+				t.Errorf("Duplicate ballot %v from proposer %d at round %d", ballot, p.id, p.round)
 			}
-			seen[num] = true
+			seen[ballot] = true
 		}
 	}
 }
 
-func TestProposalNumberLargeID(t *testing.T) {
-	env := NewPaxosEnvironment(1, 2, 3, 9999)
-	node := env.GetNodeNetwork(9999)
-	p := NewProposer(9999, "test", node, 1, 2, 3)
+func TestBallotLargeID(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 10001)
 
-	prev := 0
+	// With seq*10000+id numbering, 10001 in round 1 collided with 1 in round 2.
+	small := NewProposer(1, "small", env.GetNodeNetwork(1), 1, 2, 3)
+	large := NewProposer(10001, "large", env.GetNodeNetwork(10001), 1, 2, 3)
+
+	seen := make(map[Ballot]int)
 	for i := 0; i < 10; i++ {
-		p.seq++
-		num := p.getProposerNumber()
-		if num <= prev {
-			t.Errorf("Proposal number not monotonic for large id=9999: seq=%d produced %d, previous was %d", p.seq, num, prev)
+		for _, p := range []*Proposer{small, large} {
+			ballot := p.nextBallot()
+			if owner, ok := seen[ballot]; ok {
+				t.Errorf("ballot %v issued by both %d and %d", ballot, owner, p.id)
+			}
+			seen[ballot] = p.id
+		}
+	}
+	if b := large.ballot; b.NodeID != 10001 || !small.ballot.Less(b) {
+		t.Errorf("ballot %v of proposer 10001 should outrank %v in the same round", b, small.ballot)
+	}
+}
+
+func TestBallotOrder(t *testing.T) {
+	ordered := []Ballot{{}, {0, 5}, {1, 1}, {1, 10001}, {2, 0}, {math.MaxUint64, 3}}
+	for i := range ordered {
+		for j := range ordered {
+			if got, want := ordered[i].Less(ordered[j]), i < j; got != want {
+				t.Errorf("%v.Less(%v) = %v, want %v", ordered[i], ordered[j], got, want)
+			}
 		}
-		prev = num
 	}
 }
 
@@ -102,14 +119,14 @@ func TestReachedMajorityExact(t *testing.T) {
 	node := env.GetNodeNetwork(100)
 	p := NewProposer(100, "test", node, 1, 2, 3)
 
-	p.seq = 1
-	proposalNum := p.getProposerNumber()
+	inst := p.newInstance(0, proposal{value: "test"})
+	inst.ballot = p.nextBallot()
 
 	// Simulate 2 promises (exactly majority)
-	p.acceptors[1] = messageData{messageNumber: proposalNum}
-	p.acceptors[2] = messageData{messageNumber: proposalNum}
+	inst.acceptors[1] = messageData{ballot: inst.ballot}
+	inst.acceptors[2] = messageData{ballot: inst.ballot}
 
-	if !p.reachedMajority() {
+	if !p.reachedMajority(inst) {
 		t.Errorf("reachedMajority() should be true with exactly %d promises out of %d acceptors", 2, 3)
 	}
 }
@@ -119,16 +136,17 @@ func TestPrepareIncrementsSeqOnce(t *testing.T) {
 	node := env.GetNodeNetwork(100)
 	p := NewProposer(100, "test", node, 1, 2, 3)
 
-	p.prepare()
-	seqAfterFirst := p.seq
-	if seqAfterFirst != 1 {
-		t.Errorf("seq after first prepare: got %d, want 1", seqAfterFirst)
+	inst := p.newInstance(0, proposal{value: "test"})
+	p.prepare(inst)
+	roundAfterFirst := p.round
+	if roundAfterFirst != 1 {
+		t.Errorf("round after first prepare: got %d, want 1", roundAfterFirst)
 	}
 
-	p.prepare()
-	seqAfterSecond := p.seq
-	if seqAfterSecond != 2 {
-		t.Errorf("seq after second prepare: got %d, want 2", seqAfterSecond)
+	p.prepare(inst)
+	roundAfterSecond := p.round
+	if roundAfterSecond != 2 {
+		t.Errorf("round after second prepare: got %d, want 2", roundAfterSecond)
 	}
 }
 
@@ -137,7 +155,8 @@ func TestPrepareSendsToAllAcceptors(t *testing.T) {
 	node := env.GetNodeNetwork(100)
 	p := NewProposer(100, "test", node, 1, 2, 3)
 
-	msgs := p.prepare()
+	inst := p.newInstance(0, proposal{value: "test"})
+	msgs := p.prepare(inst)
 	if len(msgs) != 3 {
 		t.Errorf("prepare() should send to all 3 acceptors, got %d messages", len(msgs))
 	}
@@ -145,8 +164,8 @@ func TestPrepareSendsToAllAcceptors(t *testing.T) {
 		if msg.messageCategory != PrepareMessage {
 			t.Errorf("prepare() should produce PrepareMessage, got %d", msg.messageCategory)
 		}
-		if msg.messageNumber != p.proposalNumber {
-			t.Errorf("message number %d doesn't match proposal number %d", msg.messageNumber, p.proposalNumber)
+		if msg.ballot != inst.ballot {
+			t.Errorf("message ballot %v doesn't match proposal ballot %v", msg.ballot, inst.ballot)
 		}
 	}
 }
@@ -157,14 +176,15 @@ func TestPrepareResetsPromiseState(t *testing.T) {
 	p := NewProposer(100, "test", node, 1, 2, 3)
 
 	// Simulate some promises from a previous round
-	p.acceptors[1] = messageData{messageNumber: 5000}
-	p.acceptors[2] = messageData{messageNumber: 5000}
+	inst := p.newInstance(0, proposal{value: "test"})
+	inst.acceptors[1] = messageData{ballot: Ballot{0, 5000}}
+	inst.acceptors[2] = messageData{ballot: Ballot{0, 5000}}
 
 	// prepare() should reset all acceptor state
-	p.prepare()
-	for id, msg := range p.acceptors {
-		if msg.getMessageNumber() != 0 {
-			t.Errorf("acceptor %d should be reset after prepare(), got messageNumber %d", id, msg.getMessageNumber())
+	p.prepare(inst)
+	for id, msg := range inst.acceptors {
+		if !msg.getBallot().IsZero() {
+			t.Errorf("acceptor %d should be reset after prepare(), got ballot %v", id, msg.getBallot())
 		}
 	}
 }
@@ -174,51 +194,81 @@ func TestValueAdoptionP2c(t *testing.T) {
 	node := env.GetNodeNetwork(100)
 	p := NewProposer(100, "my-value", node, 1, 2, 3)
 
-	p.seq = 1
-	p.getProposerNumber()
+	inst := p.newInstance(0, proposal{value: "my-value"})
+	inst.ballot = p.nextBallot()
 
-	// Acceptor 1 reports a previously accepted value with a high proposal number
-	p.receivePromise(messageData{
+	// Acceptor 1 reports a previously accepted value with a high ballot
+	p.receivePromise(inst, messageData{
 		messageSender:   1,
-		messageNumber:   5001, // previously accepted proposal number
+		ballot:          Ballot{0, 5001}, // previously accepted ballot
 		messageCategory: AckMessage,
 		value:           "adopted-value",
 	})
 
-	// Acceptor 2 reports no previously accepted value (number matches current proposal)
-	p.receivePromise(messageData{
+	// Acceptor 2 reports no previously accepted value (ballot matches current proposal)
+	p.receivePromise(inst, messageData{
 		messageSender:   2,
-		messageNumber:   10100, // current proposal number
+		ballot:          Ballot{1, 100}, // current ballot
 		messageCategory: AckMessage,
 		value:           "my-value",
 	})
 
-	// P2c: proposer should adopt "adopted-value" because 5001 < 10100 but
+	// P2c: proposer should adopt "adopted-value" because 0.5001 < 1.100 but
 	// the highest value across all promises determines adoption
-	// Actually: 10100 > 5001, so "my-value" has the higher number
-	// Let's fix: make the accepted value have a higher number
+	// Actually: 1.100 > 0.5001, so "my-value" has the higher ballot
+	// Let's fix: make the accepted value have a higher ballot
 	p2 := NewProposer(100, "original", node, 1, 2, 3)
-	p2.seq = 2
-	p2.getProposerNumber()
+	p2.round = 1
+	inst2 := p2.newInstance(0, proposal{value: "original"})
+	inst2.ballot = p2.nextBallot()
 
-	// Acceptor 1 had previously accepted proposal 15001
-	p2.receivePromise(messageData{
+	// Acceptor 1 had previously accepted ballot 1.5001
+	p2.receivePromise(inst2, messageData{
 		messageSender:   1,
-		messageNumber:   15001,
+		ballot:          Ballot{1, 5001},
 		messageCategory: AckMessage,
 		value:           "higher-value",
 	})
 
-	// Acceptor 2 had previously accepted proposal 10002
-	p2.receivePromise(messageData{
+	// Acceptor 2 had previously accepted ballot 1.2
+	p2.receivePromise(inst2, messageData{
 		messageSender:   2,
-		messageNumber:   10002,
+		ballot:          Ballot{1, 2},
 		messageCategory: AckMessage,
 		value:           "lower-value",
 	})
 
-	if p2.proposalValue != "higher-value" {
-		t.Errorf("P2c: proposer should adopt value from highest-numbered promise, got %q, want %q", p2.proposalValue, "higher-value")
+	if inst2.proposalValue != "higher-value" {
+		t.Errorf("P2c: proposer should adopt value from highest-numbered promise, got %q, want %q", inst2.proposalValue, "higher-value")
+	}
+}
+
+func TestAdoptedValueLosesEvenWithSameBytes(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 100)
+	p := NewProposer(100, "", env.GetNodeNetwork(100), 1, 2, 3)
+	done := make(chan outcome, 1)
+	inst := p.newInstance(0, proposal{value: "same", done: done})
+
+	// Round 1 gets as far as phase 2.
+	inst.ballot = p.nextBallot()
+	first := inst.ballot
+	p.startPhase2(inst, nil, time.Now())
+
+	// Round 2 finds its own round 1 value, which is still ours.
+	inst.ballot = p.nextBallot()
+	p.receivePromise(inst, messageData{messageSender: 1, ballot: first, messageCategory: AckMessage, value: "same"})
+	if inst.adopted {
+		t.Fatal("the value proposed in round 1 was taken for another proposer's")
+	}
+
+	// Another proposer's accept of the same bytes under a higher ballot
+	// is not ours, and neither is the slot if it wins.
+	p.receivePromise(inst, messageData{
+		messageSender: 2, ballot: Ballot{first.Round, 5001}, messageCategory: AckMessage, value: "same",
+	})
+	p.report(inst)
+	if out := <-done; out.chosen {
+		t.Errorf("outcome = %+v, want the slot lost to the other proposer's value", out)
 	}
 }
 
@@ -227,15 +277,15 @@ func TestProposeOnlyToPromisedAcceptors(t *testing.T) {
 	node := env.GetNodeNetwork(100)
 	p := NewProposer(100, "test", node, 1, 2, 3)
 
-	p.seq = 1
-	p.getProposerNumber()
+	inst := p.newInstance(0, proposal{value: "test"})
+	inst.ballot = p.nextBallot()
 
 	// Only acceptors 1 and 2 promised
-	p.acceptors[1] = messageData{messageNumber: p.proposalNumber, value: "test"}
-	p.acceptors[2] = messageData{messageNumber: p.proposalNumber, value: "test"}
+	inst.acceptors[1] = messageData{ballot: inst.ballot, value: "test"}
+	inst.acceptors[2] = messageData{ballot: inst.ballot, value: "test"}
 	// Acceptor 3 did not promise (zero value)
 
-	msgs := p.propose()
+	msgs := p.propose(inst)
 	if len(msgs) != 2 {
 		t.Errorf("propose() should send only to 2 promised acceptors, got %d", len(msgs))
 	}
@@ -259,7 +309,7 @@ func TestSubmitAndClose(t *testing.T) {
 
 	var received []string
 	for v := range p.values {
-		received = append(received, v)
+		received = append(received, v.value)
 	}
 
 	if len(received) != len(values) {
@@ -272,14 +322,14 @@ func TestSubmitAndClose(t *testing.T) {
 	}
 }
 
-func TestRunSlotSetsSlotField(t *testing.T) {
+func TestInstanceMessagesCarrySlot(t *testing.T) {
 	env := NewPaxosEnvironment(1, 2, 3, 100)
 	node := env.GetNodeNetwork(100)
 	p := NewProposer(100, "test", node, 1, 2, 3)
 
 	// Set slot to 2 and verify prepare/propose messages carry that slot.
-	p.slot = 2
-	msgs := p.prepare()
+	inst := p.newInstance(2, proposal{value: "test"})
+	msgs := p.prepare(inst)
 	for _, msg := range msgs {
 		if msg.slot != 2 {
 			t.Errorf("prepare() message slot: got %d, want 2", msg.slot)
@@ -287,11 +337,11 @@ func TestRunSlotSetsSlotField(t *testing.T) {
 	}
 
 	// Simulate promises so propose() produces messages.
-	for accID := range p.acceptors {
-		p.acceptors[accID] = messageData{messageNumber: p.proposalNumber, value: "test"}
+	for accID := range inst.acceptors {
+		inst.acceptors[accID] = messageData{ballot: inst.ballot, value: "test"}
 	}
 
-	propMsgs := p.propose()
+	propMsgs := p.propose(inst)
 	for _, msg := range propMsgs {
 		if msg.slot != 2 {
 			t.Errorf("propose() message slot: got %d, want 2", msg.slot)
@@ -418,3 +468,326 @@ func TestLeaderFailover(t *testing.T) {
 		t.Fatal("TestLeaderFailover timed out")
 	}
 }
+
+func TestReceiveNackJumpsPastPromisedNumber(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 100)
+	node := env.GetNodeNetwork(100)
+	p := NewProposer(100, "test", node, 1, 2, 3)
+
+	inst := p.newInstance(0, proposal{value: "test"})
+	p.prepare(inst)
+	if p.receiveNack(inst, messageData{messageSender: 1, messageCategory: NackMessage, ballot: inst.ballot}) {
+		t.Error("NACK carrying our own number should not abort the round")
+	}
+
+	competing := Ballot{5, 101}
+	if !p.receiveNack(inst, messageData{messageSender: 1, messageCategory: NackMessage, ballot: competing}) {
+		t.Fatal("NACK carrying a higher number should abort the round")
+	}
+	p.prepare(inst)
+	if !competing.Less(inst.ballot) {
+		t.Errorf("ballot after NACK = %v, want > %v", inst.ballot, competing)
+	}
+}
+
+// startInPhase2 puts value in flight in slot 0 and feeds it promises from
+// every acceptor, so that it is waiting for accepts.
+func startInPhase2(t *testing.T, p *Proposer) *instance {
+	t.Helper()
+	now := time.Now()
+	p.start(0, proposal{value: "test"}, now)
+	inst := p.instances[0]
+	for _, acceptorID := range p.acceptors {
+		p.handle(messageData{
+			messageSender:   acceptorID,
+			messageCategory: AckMessage,
+			ballot:          inst.ballot,
+			promised:        inst.ballot,
+		}, now)
+	}
+	if inst.phase != phasePropose {
+		t.Fatalf("instance phase = %d after promises, want phase 2", inst.phase)
+	}
+	return inst
+}
+
+func TestAcceptedNeedsMajority(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 100)
+	p := NewProposer(100, "test", env.GetNodeNetwork(100), 1, 2, 3)
+	inst := startInPhase2(t, p)
+
+	accepted := messageData{messageRecipient: 100, messageCategory: AcceptedMessage, ballot: inst.ballot}
+
+	// A stale acknowledgement for an older proposal must not count.
+	stale := accepted
+	stale.messageSender, stale.ballot = 1, Ballot{inst.ballot.Round - 1, inst.ballot.NodeID}
+	if p.handle(stale, time.Now()) != nil {
+		t.Fatal("a stale accept should not decide the slot")
+	}
+	accepted.messageSender = 1
+	if p.handle(accepted, time.Now()) != nil {
+		t.Fatal("1 of 3 accepts should not decide the slot")
+	}
+	accepted.messageSender = 2
+	if p.handle(accepted, time.Now()) != inst {
+		t.Fatal("the slot should be decided after 2 of 3 acceptors accepted")
+	}
+	if len(inst.accepts) != 2 {
+		t.Errorf("accepts recorded = %d, want 2", len(inst.accepts))
+	}
+	if _, ok := p.instances[0]; ok {
+		t.Error("a decided slot should no longer be in flight")
+	}
+}
+
+func TestAcceptsAbortOnNack(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 100)
+	p := NewProposer(100, "test", env.GetNodeNetwork(100), 1, 2, 3)
+	inst := startInPhase2(t, p)
+
+	p.handle(messageData{
+		messageSender:    1,
+		messageRecipient: 100,
+		messageCategory:  NackMessage,
+		ballot:           Ballot{inst.ballot.Round + 1, inst.ballot.NodeID},
+	}, time.Now())
+	if inst.phase != phaseWaiting {
+		t.Errorf("instance phase = %d after a higher NACK, want waiting", inst.phase)
+	}
+	if p.prepared {
+		t.Error("a higher NACK should end the leader's steady state")
+	}
+}
+
+func TestRunSlotReturnsChosenValue(t *testing.T) {
+	network := NewPaxosEnvironment(1, 2, 3, 100, 101, 200)
+
+	var acceptorList []*Acceptor
+	for id := 1; id <= 3; id++ {
+		acceptorList = append(acceptorList, NewAcceptor(id, network.GetNodeNetwork(id), 200))
+	}
+	// An earlier proposer already got "earlier" accepted by a majority.
+	for _, acc := range acceptorList[:2] {
+		acc.receivePreparedMessage(messageData{messageSender: 101, ballot: Ballot{1, 101}, value: "earlier"})
+		acc.receiveProposeMessage(messageData{messageSender: 101, ballot: Ballot{1, 101}, value: "earlier"})
+	}
+	for _, acc := range acceptorList {
+		go acc.Accept()
+	}
+	defer func() {
+		for _, acc := range acceptorList {
+			acc.Stop()
+		}
+	}()
+
+	proposer := NewProposer(100, "", network.GetNodeNetwork(100), 1, 2, 3)
+	resultCh := make(chan string, 1)
+	go func() {
+		chosen, _ := proposer.runSlot(0, "mine")
+		resultCh <- chosen
+	}()
+
+	select {
+	case chosen := <-resultCh:
+		if chosen != "earlier" {
+			t.Errorf("runSlot returned %q, want the already chosen %q", chosen, "earlier")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("runSlot did not return")
+	}
+}
+
+// countingNode counts the messages a proposer sends, by category.
+type countingNode struct {
+	nodeNetwork
+	mu   sync.Mutex
+	sent map[messageType]int
+}
+
+func (c *countingNode) send(m messageData) {
+	c.mu.Lock()
+	c.sent[m.messageCategory]++
+	c.mu.Unlock()
+	c.nodeNetwork.send(m)
+}
+
+func TestSteadyStateSkipsPhaseOne(t *testing.T) {
+	network := NewPaxosEnvironment(1, 2, 3, 100, 200)
+
+	var acceptorList []*Acceptor
+	for id := 1; id <= 3; id++ {
+		acceptorList = append(acceptorList, NewAcceptor(id, network.GetNodeNetwork(id), 200))
+	}
+	for _, acc := range acceptorList {
+		go acc.Accept()
+	}
+	defer func() {
+		for _, acc := range acceptorList {
+			acc.Stop()
+		}
+	}()
+
+	node := &countingNode{nodeNetwork: network.GetNodeNetwork(100), sent: make(map[messageType]int)}
+	proposer := NewProposer(100, "", node, 1, 2, 3)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for slot, value := range []string{"alpha", "beta", "gamma"} {
+			if chosen, _ := proposer.runSlot(slot, value); chosen != value {
+				t.Errorf("slot %d: chosen %q, want %q", slot, chosen, value)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("runSlot did not finish")
+	}
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if got := node.sent[PrepareMessage]; got != 3 {
+		t.Errorf("prepare messages sent = %d, want 3 (phase 1 for the first slot only)", got)
+	}
+}
+
+// promise feeds inst a promise from every acceptor.
+func promise(p *Proposer, inst *instance, now time.Time) {
+	for _, acceptorID := range p.acceptors {
+		p.handle(messageData{
+			messageSender:   acceptorID,
+			messageCategory: AckMessage,
+			slot:            inst.slot,
+			ballot:          inst.ballot,
+			promised:        inst.ballot,
+		}, now)
+	}
+}
+
+func TestWindowKeepsSlotsInFlight(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 100)
+	p := NewProposer(100, "", env.GetNodeNetwork(100), 1, 2, 3)
+	p.SetWindow(3)
+	now := time.Now()
+
+	// Only one slot runs phase 1; the others wait for its promises.
+	for slot, value := range []string{"alpha", "beta", "gamma"} {
+		p.start(slot, proposal{value: value}, now)
+	}
+	if p.instances[0].phase != phasePrepare {
+		t.Fatalf("slot 0 phase = %d, want phase 1", p.instances[0].phase)
+	}
+	for _, slot := range []int{1, 2} {
+		if p.instances[slot].phase != phaseWaiting {
+			t.Errorf("slot %d phase = %d, want waiting while slot 0 prepares", slot, p.instances[slot].phase)
+		}
+	}
+
+	// Once phase 1 is won, every slot is proposed without waiting on the others.
+	promise(p, p.instances[0], now)
+	for slot := 0; slot < 3; slot++ {
+		inst := p.instances[slot]
+		if inst.phase != phasePropose {
+			t.Errorf("slot %d phase = %d, want phase 2", slot, inst.phase)
+		}
+		if inst.ballot != p.ballot {
+			t.Errorf("slot %d ballot = %v, want the leader's %v", slot, inst.ballot, p.ballot)
+		}
+	}
+
+	// Slots are decided independently of each other.
+	accepted := messageData{messageCategory: AcceptedMessage, slot: 2, ballot: p.ballot}
+	for _, acceptorID := range []int{1, 2} {
+		accepted.messageSender = acceptorID
+		if inst := p.handle(accepted, now); acceptorID == 2 && (inst == nil || inst.slot != 2) {
+			t.Fatal("slot 2 should be decided ahead of slots 0 and 1")
+		}
+	}
+	if len(p.instances) != 2 {
+		t.Errorf("in flight = %d, want 2", len(p.instances))
+	}
+}
+
+func TestSteadyStateSkipsOnlySlotsWithoutValues(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 100)
+	p := NewProposer(100, "", env.GetNodeNetwork(100), 1, 2, 3)
+	p.SetWindow(3)
+	now := time.Now()
+
+	for slot, value := range []string{"alpha", "beta", "gamma"} {
+		p.start(slot, proposal{value: value}, now)
+	}
+	// The acceptors hold values up to slot 1, which slot 0's phase 1 does
+	// not learn of, so slot 1 must run its own.
+	for _, acceptorID := range p.acceptors {
+		p.handle(messageData{
+			messageSender:   acceptorID,
+			messageCategory: AckMessage,
+			slot:            0,
+			ballot:          p.instances[0].ballot,
+			promised:        p.instances[0].ballot,
+			highestAccepted: 1,
+		}, now)
+	}
+	if got := p.instances[1].phase; got != phaseWaiting {
+		t.Errorf("slot 1 phase = %d, want waiting for its own phase 1", got)
+	}
+	if got := p.instances[2].phase; got != phasePropose {
+		t.Errorf("slot 2 phase = %d, want phase 2 under the leader's promises", got)
+	}
+
+	accepted := messageData{messageCategory: AcceptedMessage, slot: 0, ballot: p.ballot}
+	for _, acceptorID := range []int{1, 2} {
+		accepted.messageSender = acceptorID
+		p.handle(accepted, now)
+	}
+	if got := p.instances[1].phase; got != phasePrepare {
+		t.Errorf("slot 1 phase = %d, want phase 1 once slot 0 is decided", got)
+	}
+}
+
+func TestRunMultiPipelined(t *testing.T) {
+	network := NewPaxosEnvironment(1, 2, 3, 100, 200)
+
+	var acceptorList []*Acceptor
+	for id := 1; id <= 3; id++ {
+		acceptorList = append(acceptorList, NewAcceptor(id, network.GetNodeNetwork(id), 200))
+	}
+	for _, acc := range acceptorList {
+		go acc.Accept()
+	}
+	defer func() {
+		for _, acc := range acceptorList {
+			acc.Stop()
+		}
+	}()
+
+	proposer := NewProposer(100, "", network.GetNodeNetwork(100), 1, 2, 3)
+	proposer.SetWindow(4)
+	values := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, v := range values {
+		proposer.Submit(v)
+	}
+	proposer.Close()
+	go proposer.RunMulti()
+	defer proposer.Stop()
+
+	learner := NewLearner(200, network.GetNodeNetwork(200), 1, 2, 3)
+	resultCh := make(chan map[int]string, 1)
+	go func() {
+		resultCh <- learner.LearnMulti(len(values))
+	}()
+
+	select {
+	case decided := <-resultCh:
+		for slot, want := range values {
+			if decided[slot] != want {
+				t.Errorf("slot %d: got %q, want %q", slot, decided[slot], want)
+			}
+		}
+	case <-time.After(10 * time.Second):
+		learner.Stop()
+		t.Fatal("TestRunMultiPipelined timed out")
+	}
+}
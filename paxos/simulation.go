@@ -0,0 +1,325 @@
+package paxos
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Simulation runs a whole cluster of Nodes in a single goroutine on virtual
+// time. Message delays, faults, timeouts and backoff are all drawn from one
+// seed, and events happen in a fixed order, so a run replays exactly from its
+// seed: a schedule that breaks the cluster can be rerun until the bug is
+// found. Messages go through a FaultInjector, whose faults and partitions
+// apply just as they do to real Transports.
+type Simulation struct {
+	now    time.Time
+	rng    *rand.Rand
+	net    *FaultInjector
+	ids    []int
+	nodes  map[int]*simNode
+	events simQueue
+	seq    uint64
+}
+
+// simNode is a Node driven by a Simulation, with what it has been asked to
+// propose and what it has committed.
+type simNode struct {
+	node      *Node
+	pending   []proposal
+	committed []Entry
+	crashed   bool
+	wakeAt    time.Time // when the proposer next has work to do
+}
+
+type simEventKind int
+
+const (
+	simDeliver   simEventKind = iota // a message arrives
+	simHeartbeat                     // heartbeats go out and the leader is checked
+	simCatchup                       // the learner checks for gaps
+	simWake                          // the proposer's next timeout is due
+)
+
+// simEvent is something that happens to one node at one instant.
+type simEvent struct {
+	at   time.Time
+	seq  uint64 // orders events due at the same instant
+	node int
+	kind simEventKind
+	msg  Message
+}
+
+// simQueue is a heap of events, earliest first.
+type simQueue []*simEvent
+
+func (q simQueue) Len() int { return len(q) }
+
+func (q simQueue) Less(i, j int) bool {
+	if !q[i].at.Equal(q[j].at) {
+		return q[i].at.Before(q[j].at)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q simQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *simQueue) Push(x any) { *q = append(*q, x.(*simEvent)) }
+
+func (q *simQueue) Pop() any {
+	old := *q
+	ev := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return ev
+}
+
+// simTransport hands a simulated Node's messages to the Simulation.
+type simTransport struct {
+	sim *Simulation
+}
+
+func (t simTransport) Send(msg Message) error {
+	t.sim.send(msg)
+	return nil
+}
+
+// Receive is never called: the Simulation delivers messages itself.
+func (t simTransport) Receive(ctx context.Context) (Message, error) {
+	<-ctx.Done()
+	return Message{}, ctx.Err()
+}
+
+// NewSimulation creates a cluster of Nodes with the given IDs, each
+// configured with opts, and starts them at virtual time zero. Nothing happens
+// until the Simulation is run.
+func NewSimulation(seed uint64, ids []int, opts ...Option) *Simulation {
+	s := &Simulation{
+		now:   time.Unix(0, 0).UTC(),
+		rng:   rand.New(rand.NewPCG(seed, 0)),
+		net:   NewFaultInjector(seed),
+		ids:   slices.Clone(ids),
+		nodes: make(map[int]*simNode, len(ids)),
+	}
+	slices.Sort(s.ids)
+	for _, id := range s.ids {
+		var peerIDs []int
+		for _, pid := range s.ids {
+			if pid != id {
+				peerIDs = append(peerIDs, pid)
+			}
+		}
+		nodeOpts := append(slices.Clone(opts),
+			WithClock(s),
+			WithRand(rand.New(rand.NewPCG(seed, uint64(id)+1))),
+		)
+		sn := &simNode{node: NewNode(id, peerIDs, simTransport{sim: s}, nodeOpts...)}
+		sn.node.onCommit = func(entry Entry) {
+			sn.committed = append(sn.committed, entry)
+		}
+		s.nodes[id] = sn
+	}
+	for _, id := range s.ids {
+		n := s.nodes[id].node
+		n.requestCatchup()
+		if !n.learnOnly {
+			n.proposer.sendHeartbeats()
+		}
+		// Stagger the nodes' timers so they do not all fire at once.
+		s.schedule(s.now.Add(time.Duration(s.rng.Int64N(int64(heartbeatInterval)))), id, simHeartbeat, Message{})
+		s.schedule(s.now.Add(time.Duration(s.rng.Int64N(int64(catchupInterval)))), id, simCatchup, Message{})
+	}
+	return s
+}
+
+// Now returns the virtual time. The Simulation is its Nodes' Clock.
+func (s *Simulation) Now() time.Time {
+	return s.now
+}
+
+// SetFaults replaces the faults applied to messages sent from now on.
+func (s *Simulation) SetFaults(faults Faults) {
+	s.net.SetFaults(faults)
+}
+
+// SetDropRule drops every message rule returns true for.
+func (s *Simulation) SetDropRule(rule func(msg Message) bool) {
+	s.net.SetDropRule(rule)
+}
+
+// Partition splits the cluster so that only nodes in the same group can reach
+// each other.
+func (s *Simulation) Partition(groups ...[]int) {
+	s.net.Partition(groups...)
+}
+
+// Heal removes any partition.
+func (s *Simulation) Heal() {
+	s.net.Heal()
+}
+
+// Crash stops node id for good: it handles no more messages or timeouts.
+func (s *Simulation) Crash(id int) {
+	if sn, ok := s.nodes[id]; ok {
+		sn.crashed = true
+	}
+}
+
+// Propose queues value on node id, which proposes it once it leads, as
+// Node.Propose does.
+func (s *Simulation) Propose(id int, value []byte) {
+	if sn, ok := s.nodes[id]; ok {
+		sn.pending = append(sn.pending, proposal{value: string(value)})
+		s.schedule(s.now, id, simWake, Message{})
+	}
+}
+
+// Committed returns the entries node id has committed so far, in order.
+func (s *Simulation) Committed(id int) []Entry {
+	if sn, ok := s.nodes[id]; ok {
+		return slices.Clone(sn.committed)
+	}
+	return nil
+}
+
+// Run processes every event due within d of virtual time and moves the
+// clock on by d.
+func (s *Simulation) Run(d time.Duration) {
+	end := s.now.Add(d)
+	for len(s.events) > 0 && !s.events[0].at.After(end) {
+		s.step()
+	}
+	s.now = end
+}
+
+// RunUntil processes events until done returns true, checking after each
+// one, or until limit of virtual time has passed. It reports whether done
+// returned true.
+func (s *Simulation) RunUntil(done func() bool, limit time.Duration) bool {
+	end := s.now.Add(limit)
+	for !done() {
+		if len(s.events) == 0 || s.events[0].at.After(end) {
+			s.now = end
+			return false
+		}
+		s.step()
+	}
+	return true
+}
+
+// Check verifies that the nodes agree: no two of them committed different
+// values for the same position in the log.
+func (s *Simulation) Check() error {
+	type committed struct {
+		node  int
+		value string
+	}
+	seen := make(map[position]committed) // the first node to commit each position
+	for _, id := range s.ids {
+		for _, entry := range s.nodes[id].committed {
+			pos := position{slot: entry.Slot, index: entry.Index}
+			first, ok := seen[pos]
+			if !ok {
+				seen[pos] = committed{node: id, value: string(entry.Value)}
+				continue
+			}
+			if first.value != string(entry.Value) {
+				return fmt.Errorf("slot %d index %d: node %d committed %q, node %d committed %q",
+					entry.Slot, entry.Index, first.node, first.value, id, entry.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// schedule adds an event for node id at time at, or now if at has passed.
+func (s *Simulation) schedule(at time.Time, id int, kind simEventKind, msg Message) {
+	if at.Before(s.now) {
+		at = s.now
+	}
+	s.seq++
+	heap.Push(&s.events, &simEvent{at: at, seq: s.seq, node: id, kind: kind, msg: msg})
+}
+
+// send puts msg on the simulated network, subject to the FaultInjector.
+func (s *Simulation) send(msg Message) {
+	delays, hold := s.net.decide(msg)
+	for i, delay := range delays {
+		if hold && i == 0 {
+			delay += reorderHold
+		}
+		s.schedule(s.now.Add(delay), msg.To, simDeliver, msg)
+	}
+}
+
+// step processes the earliest event, then lets its node act on the result.
+func (s *Simulation) step() {
+	ev := heap.Pop(&s.events).(*simEvent)
+	s.now = ev.at
+	sn, ok := s.nodes[ev.node]
+	if !ok || sn.crashed {
+		return
+	}
+	n := sn.node
+	switch ev.kind {
+	case simDeliver:
+		n.router.deliverLocal(toInternalMessage(ev.msg))
+	case simHeartbeat:
+		if !n.learnOnly {
+			n.proposer.sendHeartbeats()
+			n.checkLeader()
+		}
+		s.schedule(s.now.Add(heartbeatInterval), ev.node, simHeartbeat, Message{})
+	case simCatchup:
+		n.checkCatchup()
+		s.schedule(s.now.Add(catchupInterval), ev.node, simCatchup, Message{})
+	case simWake:
+	}
+	s.settle(ev.node, sn)
+}
+
+// settle has a node handle every message queued for its roles, in a fixed
+// order, along with whatever it was asked to propose, until it has nothing
+// left to do. It then sets the proposer's next timeout.
+func (s *Simulation) settle(id int, sn *simNode) {
+	n := sn.node
+	r := n.router
+	for {
+		select {
+		case msg := <-r.acceptorCh:
+			n.acceptor.handle(msg)
+			continue
+		default:
+		}
+		select {
+		case msg := <-r.learnerCh:
+			n.handleLearnerMessage(msg)
+			continue
+		default:
+		}
+		select {
+		case msg := <-r.proposerCh:
+			n.handleProposerMessage(msg)
+			continue
+		default:
+		}
+		if n.learnOnly {
+			return
+		}
+		if len(sn.pending) > 0 && n.takesValues() {
+			n.queueProposal(sn.pending[0])
+			sn.pending = sn.pending[1:]
+			continue
+		}
+		n.proposerTick()
+		if len(r.acceptorCh)+len(r.learnerCh)+len(r.proposerCh) == 0 {
+			break
+		}
+	}
+	if at := s.now.Add(n.proposerWait()); !sn.wakeAt.After(s.now) || at.Before(sn.wakeAt) {
+		sn.wakeAt = at
+		s.schedule(at, id, simWake, Message{})
+	}
+}
@@ -0,0 +1,176 @@
+package paxos
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// runSimulation proposes count values over a lossy network, half on node 3
+// and half on node 2 while node 3 is cut off, and returns the simulation once
+// every node has committed all of them.
+func runSimulation(t *testing.T, seed uint64, count int) *Simulation {
+	t.Helper()
+	s := NewSimulation(seed, []int{1, 2, 3}, WithPipelineWindow(4))
+	s.SetFaults(Faults{Drop: 0.1, Duplicate: 0.1, Reorder: 0.1, MaxDelay: 10 * time.Millisecond})
+	for i := 0; i < count/2; i++ {
+		s.Propose(3, []byte(fmt.Sprintf("v%d", i)))
+	}
+	// A node only proposes while it leads, so each leader gets to commit its
+	// values before the partition changes who that is.
+	if !s.RunUntil(func() bool { return committedAll(s.Committed(3), count/2) }, 30*time.Second) {
+		t.Fatalf("seed %d: node 3 committed %v before the partition", seed, s.Committed(3))
+	}
+	s.Partition([]int{3})
+	for i := count / 2; i < count; i++ {
+		s.Propose(2, []byte(fmt.Sprintf("v%d", i)))
+	}
+	if !s.RunUntil(func() bool { return committedAll(s.Committed(2), count) }, 30*time.Second) {
+		t.Fatalf("seed %d: node 2 committed %v during the partition", seed, s.Committed(2))
+	}
+	s.Heal()
+	commitEverywhere(t, s, seed, count)
+	if err := s.Check(); err != nil {
+		t.Fatalf("seed %d: %v", seed, err)
+	}
+	return s
+}
+
+// commitEverywhere runs s until every node has committed the values v0 to
+// v<count-1>. Nothing more is proposed: a node that missed the votes for the
+// last slots has to catch up by itself.
+func commitEverywhere(t *testing.T, s *Simulation, seed uint64, count int) {
+	t.Helper()
+	allCommitted := func() bool {
+		for _, id := range []int{1, 2, 3} {
+			if !committedAll(s.Committed(id), count) {
+				return false
+			}
+		}
+		return true
+	}
+	if !s.RunUntil(allCommitted, time.Minute) {
+		for _, id := range []int{1, 2, 3} {
+			t.Logf("node %d committed %v", id, s.Committed(id))
+		}
+		t.Fatalf("seed %d: not every node committed the %d values within a minute of virtual time", seed, count)
+	}
+}
+
+// committedAll reports whether entries hold the values v0 to v<count-1>.
+func committedAll(entries []Entry, count int) bool {
+	found := 0
+	for _, entry := range entries {
+		var i int
+		if _, err := fmt.Sscanf(string(entry.Value), "v%d", &i); err == nil && i < count {
+			found++
+		}
+	}
+	return found == count
+}
+
+func TestSimulationDecidesUnderFaults(t *testing.T) {
+	for seed := uint64(1); seed <= 10; seed++ {
+		runSimulation(t, seed, 20)
+	}
+}
+
+func TestSimulationReplaysFromSeed(t *testing.T) {
+	first, second := runSimulation(t, 7, 20), runSimulation(t, 7, 20)
+	if !first.Now().Equal(second.Now()) {
+		t.Errorf("runs ended at %v and %v", first.Now(), second.Now())
+	}
+	for _, id := range []int{1, 2, 3} {
+		if a, b := fmt.Sprint(first.Committed(id)), fmt.Sprint(second.Committed(id)); a != b {
+			t.Errorf("node %d committed %s, then %s", id, a, b)
+		}
+	}
+}
+
+func TestSimulationSurvivesLeaderCrash(t *testing.T) {
+	s := NewSimulation(3, []int{1, 2, 3})
+	s.Propose(3, []byte("before"))
+	s.Run(2 * time.Second)
+	s.Crash(3)
+	s.Propose(2, []byte("after"))
+
+	committed := func() bool {
+		entries := s.Committed(1)
+		return len(entries) > 0 && string(entries[len(entries)-1].Value) == "after"
+	}
+	if !s.RunUntil(committed, 10*time.Second) {
+		t.Fatalf("node 1 committed %v, want the value proposed after the leader crashed", s.Committed(1))
+	}
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewLeaderFillsHoleLeftMidPipeline(t *testing.T) {
+	s := NewSimulation(5, []int{1, 2, 3}, WithPipelineWindow(4))
+	s.Propose(3, []byte("v0"))
+	if !s.RunUntil(func() bool { return len(s.Committed(1)) == 1 && len(s.Committed(2)) == 1 }, 5*time.Second) {
+		t.Fatalf("nodes 1 and 2 committed %v and %v, want v0", s.Committed(1), s.Committed(2))
+	}
+
+	// Node 3 pipelines three more values, but its proposals for slot 2
+	// never arrive. It dies while slot 2 is in flight and 3 is decided.
+	s.SetDropRule(func(msg Message) bool { return msg.Type == ProposeMsg && msg.Slot == 2 })
+	for _, v := range []string{"v1", "v2", "v3"} {
+		s.Propose(3, []byte(v))
+	}
+	decided := func(id, slot int) bool {
+		_, ok := s.nodes[id].node.learner.storage.Decided(slot)
+		return ok
+	}
+	if !s.RunUntil(func() bool { return decided(1, 3) && decided(2, 3) }, 5*time.Second) {
+		t.Fatal("slot 3 was not decided on nodes 1 and 2")
+	}
+	s.Crash(3)
+	s.SetDropRule(nil)
+
+	// Node 2 takes over and must settle slot 2 by itself: nothing else is
+	// proposed to move the log along.
+	want := []string{"v0", "v1", "v3"}
+	done := func() bool { return len(s.Committed(1)) == len(want) && len(s.Committed(2)) == len(want) }
+	if !s.RunUntil(done, 10*time.Second) {
+		t.Fatalf("nodes 1 and 2 committed %v and %v, want %q", s.Committed(1), s.Committed(2), want)
+	}
+	for _, id := range []int{1, 2} {
+		for i, entry := range s.Committed(id) {
+			if string(entry.Value) != want[i] {
+				t.Errorf("node %d committed %q at %d, want %q", id, entry.Value, i, want[i])
+			}
+		}
+	}
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLearnerCatchesUpOnLostTail(t *testing.T) {
+	s := NewSimulation(9, []int{1, 2, 3})
+	// Node 1 never hears how the last slots were decided, and nothing is
+	// proposed after them.
+	s.SetDropRule(func(msg Message) bool {
+		return msg.To == 1 && (msg.Type == AcceptMsg || msg.Type == CatchupReplyMsg) && msg.Slot >= 2
+	})
+	for i := 0; i < 4; i++ {
+		s.Propose(3, []byte(fmt.Sprintf("v%d", i)))
+	}
+	if !s.RunUntil(func() bool { return committedAll(s.Committed(3), 4) }, 10*time.Second) {
+		t.Fatalf("node 3 committed %v", s.Committed(3))
+	}
+	s.Run(2 * time.Second)
+	if got := len(s.Committed(1)); got != 2 {
+		t.Fatalf("node 1 committed %d values with the tail dropped, want 2", got)
+	}
+
+	s.SetDropRule(nil)
+	if !s.RunUntil(func() bool { return committedAll(s.Committed(1), 4) }, 5*time.Second) {
+		t.Fatalf("node 1 committed %v, want it to catch up on the lost tail", s.Committed(1))
+	}
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
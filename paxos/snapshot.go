@@ -0,0 +1,135 @@
+package paxos
+
+// Snapshot is the application's state as of a slot: Data reflects every
+// entry of every slot up to and including Slot. Data travels in a single
+// message, so it must not exceed the codec's 16 MiB value limit.
+type Snapshot struct {
+	Slot int
+	Data []byte
+}
+
+// Snapshotter lets a Node compact its log. The Node calls Snapshot from time
+// to time and forgets the slots the snapshot covers; a Node that has fallen
+// behind its peers' snapshots is brought up to date through Restore instead
+// of replaying those slots. Both are called from the goroutine that sends on
+// Committed, never concurrently with each other.
+type Snapshotter interface {
+	// Snapshot returns the application's state as of the last entry it has
+	// applied. A Slot no later than the previous snapshot's is ignored.
+	Snapshot() (Snapshot, error)
+
+	// Restore replaces the application's state with snap. Entries for slots
+	// up to snap.Slot that Committed already emitted are covered by snap and
+	// must not be applied on top of it.
+	Restore(snap Snapshot) error
+}
+
+// compactedThrough returns the slot covered by s's snapshot, or -1 if s has
+// none.
+func compactedThrough(s Storage) int {
+	snap, ok := s.Snapshot()
+	if !ok {
+		return -1
+	}
+	return snap.Slot
+}
+
+// snapshotMessage carries snap to recipient.
+func snapshotMessage(sender, recipient int, snap Snapshot) messageData {
+	return messageData{
+		messageSender:    sender,
+		messageRecipient: recipient,
+		messageCategory:  SnapshotMessage,
+		value:            string(snap.Data),
+		slot:             snap.Slot,
+	}
+}
+
+// maybeSnapshot asks the application for a snapshot once the learner has
+// delivered snapshotEvery slots since it last asked, and compacts up to it.
+func (n *Node) maybeSnapshot() {
+	if n.snapshotter == nil || n.snapshotEvery <= 0 ||
+		n.learner.nextSlot-n.lastSnapshot < n.snapshotEvery {
+		return
+	}
+	n.lastSnapshot = n.learner.nextSlot
+	snap, err := n.snapshotter.Snapshot()
+	if err != nil {
+		n.logger.Error("Could not take snapshot",
+			"Error", err,
+		)
+		return
+	}
+	if snap.Slot <= compactedThrough(n.learner.storage) || snap.Slot >= n.learner.nextSlot {
+		// Stale, or claims slots this node has not delivered.
+		return
+	}
+	snap.Data = n.members.snapshotState(snap.Data)
+	n.compact(snap)
+}
+
+// installSnapshot restores a snapshot a peer sent because this node is
+// missing slots the peer has compacted away. It returns false if the Node
+// stopped while delivering the entries the snapshot unblocked.
+func (n *Node) installSnapshot(msg messageData) bool {
+	snap := Snapshot{Slot: msg.slot, Data: []byte(msg.value)}
+	if snap.Slot < n.learner.nextSlot {
+		// We already have everything it covers, but the proposer may
+		// still have slots in flight that it covers, which no acceptor
+		// can vote on any more.
+		n.noteInstalled(snap.Slot)
+		return true
+	}
+	changes, data, err := decodeSnapshotState(snap.Data)
+	if err != nil {
+		n.logger.Error("Could not decode snapshot",
+			"Slot", snap.Slot,
+			"Error", err,
+		)
+		return true
+	}
+	if n.snapshotter == nil {
+		n.logger.Error("Cannot install snapshot without a Snapshotter",
+			"Slot", snap.Slot,
+		)
+		return true
+	}
+	if err := n.snapshotter.Restore(Snapshot{Slot: snap.Slot, Data: data}); err != nil {
+		n.logger.Error("Could not restore snapshot",
+			"Slot", snap.Slot,
+			"Error", err,
+		)
+		return true
+	}
+	n.members.restore(changes, snap.Slot)
+	from := n.learner.nextSlot
+	n.compact(snap)
+	n.lastSnapshot = n.learner.nextSlot
+	if next := int64(snap.Slot + 1); next > n.decidedNext.Load() {
+		n.decidedNext.Store(next)
+	}
+	n.noteInstalled(snap.Slot)
+	return n.deliver(n.learner.drain()) && n.learnUnblocked(from)
+}
+
+// noteInstalled records that a peer's snapshot covers the slots up to
+// through, for the proposer to drop its instances in them.
+func (n *Node) noteInstalled(through int) {
+	if int64(through) > n.installed.Load() {
+		n.installed.Store(int64(through))
+	}
+}
+
+// compact saves snap, whose data includes the membership, and drops the slot
+// state it covers.
+func (n *Node) compact(snap Snapshot) {
+	if err := n.learner.storage.SetSnapshot(snap); err != nil {
+		n.logger.Error("Could not persist snapshot",
+			"Slot", snap.Slot,
+			"Error", err,
+		)
+		return
+	}
+	n.learner.compact(snap.Slot)
+	n.members.compact(snap.Slot)
+}
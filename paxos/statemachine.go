@@ -0,0 +1,291 @@
+package paxos
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+// StateMachine is the application state replicated by a Replica. Apply is
+// called once per committed command, in commit order, on every replica, so
+// it must be deterministic: the same entries must produce the same state,
+// results and errors everywhere.
+type StateMachine interface {
+	Apply(entry Entry) ([]byte, error)
+}
+
+// SnapshotStateMachine is a StateMachine whose state can be saved and
+// restored. A Replica driving one takes the Node's snapshots from it when the
+// Node was created with WithSnapshots.
+type SnapshotStateMachine interface {
+	StateMachine
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+// commandMagic starts every slot value proposed through a Replica. A value
+// without it was proposed on the Node directly and carries no command ID.
+const commandMagic = 0xc5
+
+// commandID names a command across the cluster: origin is a random ID for
+// the Replica that proposed it, and seq counts that Replica's commands.
+type commandID struct {
+	origin uint64
+	seq    uint64
+}
+
+// encodeCommand frames command with its ID: the magic byte, origin and seq
+// as uvarints, then the command itself.
+func encodeCommand(id commandID, command []byte) []byte {
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(command))
+	buf = append(buf, commandMagic)
+	buf = binary.AppendUvarint(buf, id.origin)
+	buf = binary.AppendUvarint(buf, id.seq)
+	return append(buf, command...)
+}
+
+// decodeCommand splits a value built by encodeCommand. It reports false if
+// value is not a framed command.
+func decodeCommand(value []byte) (commandID, []byte, bool) {
+	if len(value) == 0 || value[0] != commandMagic {
+		return commandID{}, nil, false
+	}
+	d := decoder{buf: value[1:]}
+	id := commandID{origin: d.varuint(), seq: d.varuint()}
+	if d.err != nil {
+		return commandID{}, nil, false
+	}
+	return id, d.buf, true
+}
+
+// appliedSet remembers which of one origin's commands have been applied:
+// every seq up to floor, and the ones above it that arrived early.
+type appliedSet struct {
+	floor uint64
+	above map[uint64]bool
+}
+
+// add records seq as applied and reports whether it was new.
+func (s *appliedSet) add(seq uint64) bool {
+	if seq <= s.floor || s.above[seq] {
+		return false
+	}
+	if s.above == nil {
+		s.above = make(map[uint64]bool)
+	}
+	s.above[seq] = true
+	for s.above[s.floor+1] {
+		delete(s.above, s.floor+1)
+		s.floor++
+	}
+	return true
+}
+
+// position is where an entry sits in the log.
+type position struct {
+	slot  int
+	index int
+}
+
+func (p position) before(other position) bool {
+	return p.slot < other.slot || (p.slot == other.slot && p.index < other.index)
+}
+
+// applyResult is what Apply returned for a command.
+type applyResult struct {
+	value []byte
+	err   error
+}
+
+// Replica applies the entries a Node commits to a StateMachine, and answers
+// each Propose with what Apply returned for that command. Commands are tagged
+// with an ID so one committed more than once, for example after a leader
+// change, is applied only once.
+//
+// A Replica reads the Node's Committed channel itself, so nothing else should.
+// The Node must deliver in order, which is its default, and every node in the
+// cluster must propose through a Replica.
+type Replica struct {
+	node   *Node
+	sm     StateMachine
+	origin uint64
+	seq    atomic.Uint64
+
+	mu      sync.Mutex
+	waiters map[uint64]chan applyResult // seq -> Propose waiting on it
+
+	// applyMu guards the state machine and what has been applied to it,
+	// which snapshots read and restores replace from the Node's goroutine.
+	applyMu sync.Mutex
+	applied map[uint64]*appliedSet // origin -> commands applied from it
+	last    position               // the last entry applied
+}
+
+// NewReplica creates a Replica that applies node's committed entries to sm.
+func NewReplica(node *Node, sm StateMachine) *Replica {
+	r := &Replica{
+		node:    node,
+		sm:      sm,
+		origin:  rand.Uint64(),
+		waiters: make(map[uint64]chan applyResult),
+		applied: make(map[uint64]*appliedSet),
+		last:    position{slot: -1},
+	}
+	if _, ok := sm.(SnapshotStateMachine); ok && node.snapshotEvery > 0 && node.snapshotter == nil {
+		node.snapshotter = r
+	}
+	return r
+}
+
+// Start starts the Node and the goroutine that applies its entries.
+func (r *Replica) Start(ctx context.Context) {
+	r.node.Start(ctx)
+	go r.run()
+}
+
+// Stop stops the Node, which also ends the apply goroutine.
+func (r *Replica) Stop() {
+	r.node.Stop()
+}
+
+// Propose replicates command and waits until it is applied, returning what
+// Apply returned for it. A command whose slot goes to another value is
+// proposed again until it is committed. If ctx ends first the command may
+// still be applied later, but its result is dropped.
+func (r *Replica) Propose(ctx context.Context, command []byte) ([]byte, error) {
+	seq := r.seq.Add(1)
+	result := make(chan applyResult, 1)
+	r.mu.Lock()
+	r.waiters[seq] = result
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.waiters, seq)
+		r.mu.Unlock()
+	}()
+
+	value := encodeCommand(commandID{origin: r.origin, seq: seq}, command)
+	if err := r.node.Propose(ctx, value); err != nil {
+		return nil, err
+	}
+	select {
+	case res := <-result:
+		return res.value, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-r.node.done:
+		return nil, ErrStopped
+	}
+}
+
+func (r *Replica) run() {
+	for {
+		select {
+		case entry := <-r.node.Committed():
+			r.apply(entry)
+		case <-r.node.done:
+			return
+		}
+	}
+}
+
+// apply hands entry to the state machine, unless it repeats a command that
+// was already applied, and passes the result to the Propose waiting on it.
+func (r *Replica) apply(entry Entry) {
+	r.applyMu.Lock()
+	defer r.applyMu.Unlock()
+	pos := position{slot: entry.Slot, index: entry.Index}
+	if !r.last.before(pos) {
+		return // covered by a restored snapshot
+	}
+	r.last = pos
+	id, command, ok := decodeCommand(entry.Value)
+	if !ok {
+		r.sm.Apply(entry)
+		return
+	}
+	set := r.applied[id.origin]
+	if set == nil {
+		set = &appliedSet{}
+		r.applied[id.origin] = set
+	}
+	if !set.add(id.seq) {
+		return
+	}
+	entry.Value = command
+	value, err := r.sm.Apply(entry)
+	if id.origin != r.origin {
+		return
+	}
+	r.mu.Lock()
+	result, ok := r.waiters[id.seq]
+	r.mu.Unlock()
+	if ok {
+		result <- applyResult{value: value, err: err}
+	}
+}
+
+// Snapshot saves the state machine along with the commands applied to it.
+// The snapshot stops short of the slot last applied from, which may still
+// hold batched entries yet to be applied; a Replica restoring the snapshot
+// skips the ones that were.
+func (r *Replica) Snapshot() (Snapshot, error) {
+	sm, ok := r.sm.(SnapshotStateMachine)
+	if !ok {
+		return Snapshot{}, errors.New("state machine does not support snapshots")
+	}
+	r.applyMu.Lock()
+	defer r.applyMu.Unlock()
+	data, err := sm.Snapshot()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	buf := binary.AppendVarint(nil, int64(r.last.slot))
+	buf = binary.AppendVarint(buf, int64(r.last.index))
+	buf = binary.AppendUvarint(buf, uint64(len(r.applied)))
+	for origin, set := range r.applied {
+		buf = binary.AppendUvarint(buf, origin)
+		buf = binary.AppendUvarint(buf, set.floor)
+		buf = binary.AppendUvarint(buf, uint64(len(set.above)))
+		for seq := range set.above {
+			buf = binary.AppendUvarint(buf, seq)
+		}
+	}
+	return Snapshot{Slot: r.last.slot - 1, Data: append(buf, data...)}, nil
+}
+
+// Restore replaces the state machine and the record of applied commands
+// with those saved in snap.
+func (r *Replica) Restore(snap Snapshot) error {
+	sm, ok := r.sm.(SnapshotStateMachine)
+	if !ok {
+		return errors.New("state machine does not support snapshots")
+	}
+	d := decoder{buf: snap.Data}
+	last := position{slot: d.varint(), index: d.varint()}
+	count := d.varuint()
+	applied := make(map[uint64]*appliedSet)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		origin := d.varuint()
+		set := &appliedSet{floor: d.varuint(), above: make(map[uint64]bool)}
+		above := d.varuint()
+		for j := uint64(0); j < above && d.err == nil; j++ {
+			set.above[d.varuint()] = true
+		}
+		applied[origin] = set
+	}
+	if d.err != nil {
+		return fmt.Errorf("replica snapshot: %w", d.err)
+	}
+	r.applyMu.Lock()
+	defer r.applyMu.Unlock()
+	if err := sm.Restore(d.buf); err != nil {
+		return err
+	}
+	r.applied, r.last = applied, last
+	return nil
+}
@@ -0,0 +1,172 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errNotANumber = errors.New("not a number")
+
+// counter adds each command, a decimal number, to a running total and
+// returns the new total.
+type counter struct {
+	mu      sync.Mutex
+	total   int
+	applied []Entry
+}
+
+func (c *counter) Apply(entry Entry) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.applied = append(c.applied, entry)
+	n, err := strconv.Atoi(string(entry.Value))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", errNotANumber, entry.Value)
+	}
+	c.total += n
+	return []byte(strconv.Itoa(c.total)), nil
+}
+
+func (c *counter) state() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total, len(c.applied)
+}
+
+func TestCommandRoundTrip(t *testing.T) {
+	id := commandID{origin: 1<<63 + 5, seq: 42}
+	gotID, command, ok := decodeCommand(encodeCommand(id, []byte("set x")))
+	if !ok || gotID != id || string(command) != "set x" {
+		t.Errorf("decodeCommand = %v, %q, %v; want %v, %q, true", gotID, command, ok, id, "set x")
+	}
+	if _, _, ok := decodeCommand([]byte("plain")); ok {
+		t.Error("decodeCommand accepted a value without the command magic")
+	}
+}
+
+func TestAppliedSet(t *testing.T) {
+	var s appliedSet
+	for _, seq := range []uint64{1, 3, 2, 5} {
+		if !s.add(seq) {
+			t.Errorf("add(%d) = false for a new seq", seq)
+		}
+	}
+	for _, seq := range []uint64{1, 2, 3, 5} {
+		if s.add(seq) {
+			t.Errorf("add(%d) = true for a repeated seq", seq)
+		}
+	}
+	if s.floor != 3 || len(s.above) != 1 {
+		t.Errorf("floor = %d with %d above, want 3 with 1 above", s.floor, len(s.above))
+	}
+}
+
+func TestReplicaAppliesDuplicateOnce(t *testing.T) {
+	sm := &counter{}
+	r := NewReplica(NewNode(1, nil, NewChannelTransportGroup(1)[1]), sm)
+	other := commandID{origin: r.origin + 1, seq: 1}
+	r.apply(Entry{Slot: 0, Value: encodeCommand(other, []byte("2"))})
+	r.apply(Entry{Slot: 1, Value: encodeCommand(other, []byte("2"))})
+	r.apply(Entry{Slot: 2, Value: encodeCommand(commandID{origin: r.origin, seq: 1}, []byte("3"))})
+	if total, applied := sm.state(); total != 5 || applied != 2 {
+		t.Errorf("total %d from %d commands, want 5 from 2", total, applied)
+	}
+	if got := sm.applied[1].Slot; got != 2 {
+		t.Errorf("second command applied from slot %d, want 2", got)
+	}
+}
+
+func TestReplicaProposeReturnsResult(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, nil)
+	replicas := make(map[int]*Replica)
+	machines := make(map[int]*counter)
+	for id, node := range nodes {
+		machines[id] = &counter{}
+		replicas[id] = NewReplica(node, machines[id])
+		go replicas[id].run()
+	}
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i, want := range []string{"1", "3", "6"} {
+		got, err := replicas[3].Propose(ctx, []byte(strconv.Itoa(i+1)))
+		if err != nil {
+			t.Fatalf("Propose(%d): %v", i+1, err)
+		}
+		if string(got) != want {
+			t.Errorf("Propose(%d) = %q, want %q", i+1, got, want)
+		}
+	}
+	if _, err := replicas[3].Propose(ctx, []byte("x")); !errors.Is(err, errNotANumber) {
+		t.Errorf("Propose(x) error = %v, want errNotANumber", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for id, sm := range machines {
+		for {
+			total, applied := sm.state()
+			if total == 6 && applied == 4 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("replica %d: total %d from %d commands, want 6 from 4", id, total, applied)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func (c *counter) Snapshot() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return []byte(strconv.Itoa(c.total)), nil
+}
+
+func (c *counter) Restore(data []byte) error {
+	total, err := strconv.Atoi(string(data))
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total = total
+	return nil
+}
+
+func TestReplicaSnapshotRoundTrip(t *testing.T) {
+	node := NewNode(1, nil, NewChannelTransportGroup(1)[1])
+	r := NewReplica(node, &counter{})
+	other := commandID{origin: r.origin + 1, seq: 1}
+	r.apply(Entry{Slot: 0, Value: encodeCommand(other, []byte("2"))})
+	r.apply(Entry{Slot: 1, Index: 0, Value: []byte("3")})
+	r.apply(Entry{Slot: 1, Index: 1, Value: []byte("4")})
+
+	snap, err := r.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if snap.Slot != 0 {
+		t.Errorf("snapshot slot = %d, want 0, short of the slot still being applied", snap.Slot)
+	}
+
+	sm := &counter{}
+	restored := NewReplica(node, sm)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	// Replaying slot 1 applies only what the snapshot had not, and the
+	// command from slot 0 is still known when it turns up again.
+	restored.apply(Entry{Slot: 1, Index: 0, Value: []byte("3")})
+	restored.apply(Entry{Slot: 1, Index: 1, Value: []byte("4")})
+	restored.apply(Entry{Slot: 1, Index: 2, Value: []byte("5")})
+	restored.apply(Entry{Slot: 2, Value: encodeCommand(other, []byte("2"))})
+	if total, applied := sm.state(); total != 14 || applied != 1 {
+		t.Errorf("total %d from %d commands after restore, want 14 from 1", total, applied)
+	}
+}
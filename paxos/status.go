@@ -0,0 +1,186 @@
+package paxos
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// statusSlots is how many of the latest slots the acceptor reports on.
+const statusSlots = 16
+
+// nodeStatus is what a Node believes, as served by StatusHandler.
+type nodeStatus struct {
+	ID       int             `json:"id"`
+	Leader   int             `json:"leader"` // -1 if no leader is known
+	Proposer *proposerStatus `json:"proposer,omitempty"`
+	Acceptor *acceptorStatus `json:"acceptor,omitempty"`
+	Learner  learnerStatus   `json:"learner"`
+	Queues   queueStatus     `json:"queues"`
+}
+
+type proposerStatus struct {
+	Leading  bool   `json:"leading"`
+	Ballot   string `json:"ballot"`   // of the most recent phase 1
+	Prepared bool   `json:"prepared"` // phase 1 holds, so new slots skip it
+	NextSlot int    `json:"nextSlot"` // the slot the next value goes in
+	InFlight []int  `json:"inFlight"`
+}
+
+type acceptorStatus struct {
+	Promised string       `json:"promised"` // the promise binding every slot
+	Slots    []slotStatus `json:"slots"`    // the latest slots accepted in, lowest first
+}
+
+type slotStatus struct {
+	Slot     int    `json:"slot"`
+	Promised string `json:"promised"`
+	Accepted string `json:"accepted"`
+}
+
+type learnerStatus struct {
+	NextSlot       int   `json:"nextSlot"`       // the lowest slot not yet delivered
+	HighestDecided int   `json:"highestDecided"` // -1 if none
+	Pending        []int `json:"pending"`        // decided, waiting on an earlier slot
+}
+
+// queueStatus counts the messages waiting for each role.
+type queueStatus struct {
+	Proposer int `json:"proposer"`
+	Acceptor int `json:"acceptor"`
+	Learner  int `json:"learner"`
+}
+
+// publishedStatus holds the proposer's and learner's status as their
+// goroutines last copied it out. Reading it never waits on those goroutines,
+// which may be stuck, say delivering to a Committed channel nobody drains.
+type publishedStatus struct {
+	mu       sync.Mutex
+	proposer proposerStatus
+	leader   int
+	learner  learnerStatus
+}
+
+// publishProposerStatus must run on the proposer's goroutine.
+func (n *Node) publishProposerStatus() {
+	ps, leader := n.proposerStatus(), n.proposer.leader()
+	n.published.mu.Lock()
+	defer n.published.mu.Unlock()
+	n.published.proposer, n.published.leader = ps, leader
+}
+
+// publishLearnerStatus must run on the learner's goroutine.
+func (n *Node) publishLearnerStatus() {
+	ls := n.learnerStatus()
+	n.published.mu.Lock()
+	defer n.published.mu.Unlock()
+	n.published.learner = ls
+}
+
+// status collects the Node's view of the protocol. The proposer and learner
+// report what they last published, which may trail their state by the
+// message they are handling; the acceptor's state is all in Storage, which
+// is safe to read from anywhere. A Node that was never started has no
+// goroutines to publish, so its state is read directly.
+func (n *Node) status() (nodeStatus, error) {
+	select {
+	case <-n.done:
+		return nodeStatus{}, ErrStopped
+	default:
+	}
+	s := nodeStatus{
+		ID:     n.id,
+		Leader: -1,
+		Queues: queueStatus{
+			Proposer: len(n.router.proposerCh),
+			Acceptor: len(n.router.acceptorCh),
+			Learner:  len(n.router.learnerCh),
+		},
+	}
+	var ps proposerStatus
+	if n.started.Load() {
+		n.published.mu.Lock()
+		ps, s.Leader, s.Learner = n.published.proposer, n.published.leader, n.published.learner
+		n.published.mu.Unlock()
+	} else {
+		s.Learner = n.learnerStatus()
+		if !n.learnOnly {
+			ps, s.Leader = n.proposerStatus(), n.proposer.leader()
+		}
+	}
+	if !n.learnOnly {
+		as := n.acceptorStatus()
+		s.Proposer, s.Acceptor = &ps, &as
+	}
+	return s, nil
+}
+
+// proposerStatus must run on the proposer's goroutine.
+func (n *Node) proposerStatus() proposerStatus {
+	p := n.proposer
+	inFlight := make([]int, 0, len(p.instances))
+	for slot := range p.instances {
+		inFlight = append(inFlight, slot)
+	}
+	sort.Ints(inFlight)
+	return proposerStatus{
+		Leading:  p.isLeader,
+		Ballot:   p.ballot.String(),
+		Prepared: p.prepared,
+		NextSlot: max(n.nextSlot, int(n.decidedNext.Load())),
+		InFlight: inFlight,
+	}
+}
+
+func (n *Node) acceptorStatus() acceptorStatus {
+	a := n.acceptor
+	s := acceptorStatus{
+		Promised: a.promised(globalPromiseSlot).getBallot().String(),
+		Slots:    []slotStatus{},
+	}
+	highest := a.storage.HighestAccepted()
+	from := max(highest-statusSlots+1, compactedThrough(a.storage)+1, 0)
+	for slot := from; slot <= highest; slot++ {
+		s.Slots = append(s.Slots, slotStatus{
+			Slot:     slot,
+			Promised: a.promised(slot).getBallot().String(),
+			Accepted: a.accepted(slot).getBallot().String(),
+		})
+	}
+	return s
+}
+
+// learnerStatus must run on the learner's goroutine.
+func (n *Node) learnerStatus() learnerStatus {
+	l := n.learner
+	pending := make([]int, 0, len(l.pending))
+	for slot := range l.pending {
+		pending = append(pending, slot)
+	}
+	sort.Ints(pending)
+	return learnerStatus{
+		NextSlot:       l.nextSlot,
+		HighestDecided: int(n.decidedNext.Load()) - 1,
+		Pending:        pending,
+	}
+}
+
+// StatusHandler returns an http.Handler that serves, as JSON, what the Node
+// believes: the leader, its proposer's ballot and slots, its acceptor's
+// promises and accepts in the latest slots, its learner's progress, and how
+// many messages wait for each role. It is for debugging a stalled cluster;
+// the format may change. A stopped Node answers 503.
+func (n *Node) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := n.status()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(s)
+	})
+}
@@ -0,0 +1,123 @@
+package paxos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fetchStatus fetches n's status and decodes it.
+func fetchStatus(t *testing.T, n *Node) nodeStatus {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	n.StatusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %q, want 200", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var s nodeStatus
+	if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+		t.Fatalf("decoding status: %v", err)
+	}
+	return s
+}
+
+func TestNodeStatus(t *testing.T) {
+	nodes := startTestCluster(t, []int{1, 2, 3}, nil)
+	waitForLeader(t, nodes, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, v := range []string{"alpha", "beta"} {
+		if _, err := nodes[3].ProposeAndWait(ctx, []byte(v)); err != nil {
+			t.Fatalf("ProposeAndWait(%q): %v", v, err)
+		}
+		select {
+		case <-nodes[3].Committed():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("node 3 did not commit %q", v)
+		}
+	}
+
+	leader := fetchStatus(t, nodes[3])
+	if leader.ID != 3 || leader.Leader != 3 {
+		t.Errorf("node 3 reports ID %d and leader %d, want 3 and 3", leader.ID, leader.Leader)
+	}
+	if p := leader.Proposer; p == nil || !p.Leading || p.NextSlot != 2 || len(p.InFlight) != 0 {
+		t.Errorf("leader's proposer = %+v, want leading with slot 2 next and nothing in flight", p)
+	}
+	if l := leader.Learner; l.NextSlot != 2 || l.HighestDecided != 1 || len(l.Pending) != 0 {
+		t.Errorf("leader's learner = %+v, want slots 0 and 1 delivered", l)
+	}
+
+	follower := fetchStatus(t, nodes[1])
+	if follower.Leader != 3 || follower.Proposer == nil || follower.Proposer.Leading {
+		t.Errorf("node 1 reports leader %d and proposer %+v, want a follower of 3", follower.Leader, follower.Proposer)
+	}
+	ballot := leader.Proposer.Ballot
+	for id, n := range nodes {
+		a := fetchStatus(t, n).Acceptor
+		if a == nil || a.Promised != ballot {
+			t.Errorf("node %d's acceptor = %+v, want a promise of %s", id, a, ballot)
+		}
+	}
+}
+
+func TestStoppedNodeStatus(t *testing.T) {
+	n := NewNode(1, nil, NewChannelTransportGroup(1)[1])
+	if s := fetchStatus(t, n); s.ID != 1 || s.Learner.HighestDecided != -1 {
+		t.Errorf("unstarted node's status = %+v, want node 1 with nothing decided", s)
+	}
+
+	n.Start(context.Background())
+	n.Stop()
+	rec := httptest.NewRecorder()
+	n.StatusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("stopped node's status = %d, want 503", rec.Code)
+	}
+}
+
+func TestNodeStatusWhileCommittedIsNotDrained(t *testing.T) {
+	n := NewNode(1, nil, NewChannelTransportGroup(1)[1])
+	n.Start(context.Background())
+	defer n.Stop()
+
+	// Nobody reads Committed, so the learner blocks once its buffer fills.
+	ctx := context.Background()
+	for i := 0; i <= cap(n.committed); i++ {
+		if err := n.Propose(ctx, []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("Propose(v%d): %v", i, err)
+		}
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for len(n.committed) < cap(n.committed) {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d entries committed", len(n.committed))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	fetched := make(chan nodeStatus, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		n.StatusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+		var s nodeStatus
+		json.NewDecoder(rec.Body).Decode(&s)
+		fetched <- s
+	}()
+	select {
+	case s := <-fetched:
+		if s.Learner.NextSlot < cap(n.committed) {
+			t.Errorf("learner's next slot = %d, want at least the %d entries buffered", s.Learner.NextSlot, cap(n.committed))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("status did not answer while the learner was blocked on Committed")
+	}
+}
@@ -0,0 +1,160 @@
+package paxos
+
+import "sync"
+
+// Storage holds the state a Paxos node must not lose: the acceptor's promised
+// and accepted proposals per slot, the values the learner has decided, and
+// the latest snapshot, which stands in for every slot up to its own.
+// A Node shares one Storage between its acceptor and learner, so
+// implementations must be safe for concurrent use.
+type Storage interface {
+	// Promised returns the highest Prepare promised for slot.
+	Promised(slot int) (Message, bool)
+	SetPromised(slot int, msg Message) error
+
+	// Accepted returns the proposal most recently accepted for slot.
+	Accepted(slot int) (Message, bool)
+	SetAccepted(slot int, msg Message) error
+	// HighestAccepted returns the highest slot a proposal has been accepted
+	// in, counting the slots the snapshot covers, or -1 if there is none.
+	HighestAccepted() int
+
+	// Decided returns the value chosen for slot.
+	Decided(slot int) ([]byte, bool)
+	SetDecided(slot int, value []byte) error
+
+	// Snapshot returns the latest snapshot saved.
+	Snapshot() (Snapshot, bool)
+	// SetSnapshot saves snap and discards the promised, accepted and decided
+	// state of every slot up to snap.Slot. A snap no newer than the saved one
+	// is ignored.
+	SetSnapshot(snap Snapshot) error
+}
+
+// MemoryStorage is a Storage kept entirely in memory. It is the default and
+// offers no durability across restarts.
+type MemoryStorage struct {
+	mu       sync.RWMutex
+	promised map[int]Message
+	accepted map[int]Message
+	decided  map[int][]byte
+	snapshot *Snapshot
+	highest  int // the highest slot accepted in or covered by the snapshot
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		promised: make(map[int]Message),
+		accepted: make(map[int]Message),
+		decided:  make(map[int][]byte),
+		highest:  -1,
+	}
+}
+
+func (s *MemoryStorage) Promised(slot int) (Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	msg, ok := s.promised[slot]
+	return msg, ok
+}
+
+func (s *MemoryStorage) SetPromised(slot int, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.promised[slot] = msg
+	return nil
+}
+
+func (s *MemoryStorage) Accepted(slot int) (Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	msg, ok := s.accepted[slot]
+	return msg, ok
+}
+
+func (s *MemoryStorage) SetAccepted(slot int, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accepted[slot] = msg
+	s.highest = max(s.highest, slot)
+	return nil
+}
+
+func (s *MemoryStorage) HighestAccepted() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.highest
+}
+
+func (s *MemoryStorage) Decided(slot int) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.decided[slot]
+	return value, ok
+}
+
+func (s *MemoryStorage) SetDecided(slot int, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decided[slot] = value
+	return nil
+}
+
+func (s *MemoryStorage) Snapshot() (Snapshot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.snapshot == nil {
+		return Snapshot{}, false
+	}
+	return *s.snapshot, true
+}
+
+func (s *MemoryStorage) SetSnapshot(snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot != nil && snap.Slot <= s.snapshot.Slot {
+		return nil
+	}
+	s.snapshot = &snap
+	s.highest = max(s.highest, snap.Slot)
+	// Slots below zero hold node-wide state, such as the global promise.
+	for slot := range s.promised {
+		if slot >= 0 && slot <= snap.Slot {
+			delete(s.promised, slot)
+		}
+	}
+	for slot := range s.accepted {
+		if slot >= 0 && slot <= snap.Slot {
+			delete(s.accepted, slot)
+		}
+	}
+	for slot := range s.decided {
+		if slot <= snap.Slot {
+			delete(s.decided, slot)
+		}
+	}
+	return nil
+}
+
+// records returns the state held by s as the messages that rebuild it when
+// replayed in order, the snapshot first.
+func (s *MemoryStorage) records() []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var msgs []Message
+	if s.snapshot != nil {
+		msgs = append(msgs, Message{Type: SnapshotMsg, Slot: s.snapshot.Slot, Value: s.snapshot.Data})
+	}
+	for slot, msg := range s.promised {
+		msg.Type, msg.Slot = PrepareMsg, slot
+		msgs = append(msgs, msg)
+	}
+	for slot, msg := range s.accepted {
+		msg.Type, msg.Slot = ProposeMsg, slot
+		msgs = append(msgs, msg)
+	}
+	for slot, value := range s.decided {
+		msgs = append(msgs, Message{Type: AcceptMsg, Slot: slot, Value: value})
+	}
+	return msgs
+}
@@ -0,0 +1,131 @@
+package paxos
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// failingStorage rejects every write, as a full or broken disk would.
+type failingStorage struct {
+	*MemoryStorage
+}
+
+var errDiskFull = errors.New("disk full")
+
+func (failingStorage) SetPromised(int, Message) error { return errDiskFull }
+func (failingStorage) SetAccepted(int, Message) error { return errDiskFull }
+func (failingStorage) SetDecided(int, []byte) error   { return errDiskFull }
+
+func TestAcceptorRefusesWhenStorageFails(t *testing.T) {
+	a, _ := newTestAcceptor(1)
+	a.SetStorage(failingStorage{NewMemoryStorage()})
+
+	ack := a.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{1, 100}, messageCategory: PrepareMessage,
+	})
+	if ack != nil {
+		t.Error("acceptor must not promise when the promise cannot be stored")
+	}
+	if a.receiveProposeMessage(messageData{
+		messageSender: 100, ballot: Ballot{1, 100}, messageCategory: ProposeMessage,
+	}) {
+		t.Error("acceptor must not accept when the proposal cannot be stored")
+	}
+}
+
+func TestAcceptorUsesProvidedStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	storage.SetPromised(4, Message{From: 100, Ballot: Ballot{2, 100}, Type: PrepareMsg, Slot: 4})
+
+	a, _ := newTestAcceptor(1)
+	a.SetStorage(storage)
+
+	if ack := a.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{1, 100}, messageCategory: PrepareMessage, slot: 4,
+	}); ack != nil {
+		t.Error("acceptor ignored the promise already held by its storage")
+	}
+	a.receiveProposeMessage(messageData{
+		messageSender: 100, ballot: Ballot{2, 100}, messageCategory: ProposeMessage, value: "stored", slot: 4,
+	})
+	if msg, ok := storage.Accepted(4); !ok || string(msg.Value) != "stored" {
+		t.Errorf("storage accepted = (%+v, %v), want value %q", msg, ok, "stored")
+	}
+}
+
+func TestLearnerDecidesOnce(t *testing.T) {
+	env := NewPaxosEnvironment(1, 2, 3, 200)
+	l := NewLearner(200, env.GetNodeNetwork(200), 1, 2, 3)
+
+	if !l.decide(0, "alpha") {
+		t.Error("first decision for slot 0 should be new")
+	}
+	if l.decide(0, "alpha") {
+		t.Error("second decision for slot 0 should not be new")
+	}
+	if value, ok := l.storage.Decided(0); !ok || string(value) != "alpha" {
+		t.Errorf("decided slot 0 = (%q, %v), want %q", value, ok, "alpha")
+	}
+}
+
+func TestWALPersistsDecidedValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	w, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	env := NewPaxosEnvironment(1, 2, 3, 200)
+	l := NewLearner(200, env.GetNodeNetwork(200), 1, 2, 3)
+	l.SetStorage(w)
+	l.decide(2, "gamma")
+	w.Close()
+
+	w, err = OpenWAL(path)
+	if err != nil {
+		t.Fatalf("reopen OpenWAL: %v", err)
+	}
+	defer w.Close()
+	if value, ok := w.Decided(2); !ok || string(value) != "gamma" {
+		t.Errorf("decided slot 2 after reopen = (%q, %v), want %q", value, ok, "gamma")
+	}
+}
+
+func TestMemoryStorageSnapshotCompacts(t *testing.T) {
+	s := NewMemoryStorage()
+	for slot := 0; slot < 4; slot++ {
+		s.SetPromised(slot, Message{Ballot: Ballot{1, 100}})
+		s.SetAccepted(slot, Message{Ballot: Ballot{1, 100}, Value: []byte("v")})
+		s.SetDecided(slot, []byte("v"))
+	}
+	s.SetPromised(globalPromiseSlot, Message{Ballot: Ballot{1, 100}})
+
+	s.SetSnapshot(Snapshot{Slot: 2, Data: []byte("state")})
+	for slot := 0; slot <= 2; slot++ {
+		_, promised := s.Promised(slot)
+		_, accepted := s.Accepted(slot)
+		_, decided := s.Decided(slot)
+		if promised || accepted || decided {
+			t.Errorf("slot %d kept state after a snapshot covering it", slot)
+		}
+	}
+	if _, ok := s.Decided(3); !ok {
+		t.Error("slot 3 is past the snapshot but was dropped")
+	}
+	if _, ok := s.Promised(globalPromiseSlot); !ok {
+		t.Error("the global promise was dropped by compaction")
+	}
+
+	if got := s.HighestAccepted(); got != 3 {
+		t.Errorf("HighestAccepted() = %d, want 3", got)
+	}
+	s.SetSnapshot(Snapshot{Slot: 5, Data: []byte("later")})
+	if got := s.HighestAccepted(); got != 5 {
+		t.Errorf("HighestAccepted() = %d, want 5, counting the slots the snapshot covers", got)
+	}
+
+	s.SetSnapshot(Snapshot{Slot: 1, Data: []byte("older")})
+	if snap, _ := s.Snapshot(); snap.Slot != 5 || string(snap.Data) != "later" {
+		t.Errorf("snapshot = %+v, want the newer one at slot 5 kept", snap)
+	}
+}
@@ -0,0 +1,326 @@
+package paxos
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrTransportClosed is returned by a Transport that has been closed.
+var ErrTransportClosed = errors.New("transport closed")
+
+const (
+	tcpDialTimeout   = time.Second
+	tcpWriteTimeout  = time.Second
+	tcpMinRedial     = 50 * time.Millisecond
+	tcpMaxRedial     = 2 * time.Second
+	tcpSendQueueSize = 1024
+	tcpMaxFrameSize  = 16 << 20
+)
+
+// TCPTransport is a Transport that carries messages between processes over TCP.
+// Every message is sent as a frame: a 4-byte big-endian length followed by the
+// MarshalMessage encoding. Outbound connections are dialed lazily and
+// re-dialed with backoff when a peer goes away, so peers may restart freely.
+type TCPTransport struct {
+	id       int
+	listener net.Listener
+	inbound  chan Message
+	rejects  chan error // frames that arrived but could not be decoded
+	peers    map[int]*tcpPeer
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{} // accepted inbound connections
+
+	peersMu sync.RWMutex // guards peers, which AddPeer extends
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// tcpPeer is the outbound side of the connection to one remote node.
+type tcpPeer struct {
+	id    int
+	addr  string
+	queue chan []byte
+}
+
+// NewTCPTransport listens on addrs[id] and prepares outbound connections to
+// every other address in addrs.
+func NewTCPTransport(id int, addrs map[int]string) (*TCPTransport, error) {
+	addr, ok := addrs[id]
+	if !ok {
+		return nil, fmt.Errorf("tcpTransport: no address for node %d", id)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("tcpTransport: listen on %s: %w", addr, err)
+	}
+
+	t := &TCPTransport{
+		id:       id,
+		listener: listener,
+		inbound:  make(chan Message, 1024),
+		rejects:  make(chan error, errorBuffer),
+		peers:    make(map[int]*tcpPeer, len(addrs)),
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+	for peerID, peerAddr := range addrs {
+		if peerID == id {
+			continue
+		}
+		t.peers[peerID] = &tcpPeer{
+			id:    peerID,
+			addr:  peerAddr,
+			queue: make(chan []byte, tcpSendQueueSize),
+		}
+	}
+
+	t.wg.Add(1 + len(t.peers))
+	go t.acceptLoop()
+	for _, peer := range t.peers {
+		go t.writeLoop(peer)
+	}
+	return t, nil
+}
+
+// Addr returns the address this transport is listening on.
+func (t *TCPTransport) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Send queues msg for delivery to msg.To. Delivery is best effort: messages
+// to an unreachable peer are dropped, as Paxos already tolerates lost messages.
+func (t *TCPTransport) Send(msg Message) error {
+	select {
+	case <-t.done:
+		return ErrTransportClosed
+	default:
+	}
+	if msg.To == t.id {
+		select {
+		case t.inbound <- msg:
+			return nil
+		case <-t.done:
+			return ErrTransportClosed
+		}
+	}
+	t.peersMu.RLock()
+	peer, ok := t.peers[msg.To]
+	t.peersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("tcpTransport: unknown recipient %d", msg.To)
+	}
+	payload, err := MarshalMessage(msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case peer.queue <- payload:
+		return nil
+	default:
+		return fmt.Errorf("tcpTransport: send queue to %d is full", msg.To)
+	}
+}
+
+// AddPeer prepares an outbound connection to a node that joined the cluster
+// after the transport was created, such as one replacing a dead machine. An
+// existing peer keeps its address.
+func (t *TCPTransport) AddPeer(id int, addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+	t.peersMu.Lock()
+	defer t.peersMu.Unlock()
+	if _, ok := t.peers[id]; ok || id == t.id {
+		return
+	}
+	peer := &tcpPeer{
+		id:    id,
+		addr:  addr,
+		queue: make(chan []byte, tcpSendQueueSize),
+	}
+	t.peers[id] = peer
+	t.wg.Add(1)
+	go t.writeLoop(peer)
+}
+
+// Receive returns the next message from a peer. A frame that arrived but
+// could not be decoded is returned as an error wrapping the codec error; the
+// transport carries on, and Receive can be called again.
+func (t *TCPTransport) Receive(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-t.inbound:
+		return msg, nil
+	case err := <-t.rejects:
+		return Message{}, err
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-t.done:
+		return Message{}, ErrTransportClosed
+	}
+}
+
+// Close stops the listener, tears down all connections and waits for the
+// background goroutines to exit.
+func (t *TCPTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		err = t.listener.Close()
+		t.mu.Lock()
+		for conn := range t.conns {
+			conn.Close()
+		}
+		t.mu.Unlock()
+		t.wg.Wait()
+	})
+	return err
+}
+
+func (t *TCPTransport) acceptLoop() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.mu.Lock()
+		select {
+		case <-t.done:
+			t.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		t.conns[conn] = struct{}{}
+		t.wg.Add(1)
+		t.mu.Unlock()
+		go t.readLoop(conn)
+	}
+}
+
+func (t *TCPTransport) readLoop(conn net.Conn) {
+	defer t.wg.Done()
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(reader, tcpMaxFrameSize)
+		if err != nil {
+			return
+		}
+		msg, err := UnmarshalMessage(frame)
+		if err != nil {
+			select {
+			case t.rejects <- fmt.Errorf("tcpTransport: from %s: %w", conn.RemoteAddr(), err):
+			case <-t.done:
+				return
+			}
+			// A frame that fails its checksum may have a corrupt length
+			// too, so the stream can no longer be trusted. Any other
+			// frame was read whole, and the next one starts after it.
+			if errors.Is(err, ErrChecksumMismatch) {
+				return
+			}
+			continue
+		}
+		select {
+		case t.inbound <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *TCPTransport) writeLoop(peer *tcpPeer) {
+	defer t.wg.Done()
+	var conn net.Conn
+	var writer *bufio.Writer
+	var nextDial time.Time
+	backoff := tcpMinRedial
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		var payload []byte
+		select {
+		case payload = <-peer.queue:
+		case <-t.done:
+			return
+		}
+
+		if conn == nil {
+			if time.Now().Before(nextDial) {
+				continue
+			}
+			c, err := net.DialTimeout("tcp", peer.addr, tcpDialTimeout)
+			if err != nil {
+				nextDial = time.Now().Add(backoff)
+				backoff = min(backoff*2, tcpMaxRedial)
+				continue
+			}
+			conn = c
+			writer = bufio.NewWriter(conn)
+			backoff = tcpMinRedial
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+		err := writeFrame(writer, payload)
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			conn.Close()
+			conn = nil
+			writer = nil
+		}
+	}
+}
+
+func writeFrame(w io.Writer, payload []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads one frame, refusing any whose payload is over limit bytes.
+func readFrame(r io.Reader, limit int) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if int64(size) > int64(limit) {
+		return nil, fmt.Errorf("frame of %d bytes exceeds limit of %d", size, limit)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,293 @@
+package paxos
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net"
+	"testing"
+	"time"
+)
+
+// freeAddrs reserves n loopback addresses for TCP transports.
+func freeAddrs(t *testing.T, ids ...int) map[int]string {
+	t.Helper()
+	addrs := make(map[int]string, len(ids))
+	for _, id := range ids {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("reserve address: %v", err)
+		}
+		addrs[id] = l.Addr().String()
+		l.Close()
+	}
+	return addrs
+}
+
+func TestTCPTransportSendReceive(t *testing.T) {
+	addrs := freeAddrs(t, 1, 2)
+	t1, err := NewTCPTransport(1, addrs)
+	if err != nil {
+		t.Fatalf("NewTCPTransport(1): %v", err)
+	}
+	defer t1.Close()
+	t2, err := NewTCPTransport(2, addrs)
+	if err != nil {
+		t.Fatalf("NewTCPTransport(2): %v", err)
+	}
+	defer t2.Close()
+
+	want := Message{From: 1, To: 2, Type: PrepareMsg, Ballot: Ballot{1, 1}, Value: []byte("hello"), Slot: 7}
+	if err := t1.Send(want); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := t2.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if got.From != want.From || got.To != want.To || got.Type != want.Type ||
+		got.Ballot != want.Ballot || got.Slot != want.Slot || string(got.Value) != string(want.Value) {
+		t.Errorf("received %+v, want %+v", got, want)
+	}
+}
+
+func TestTCPTransportAddPeer(t *testing.T) {
+	addrs := freeAddrs(t, 1, 2)
+	t1, err := NewTCPTransport(1, map[int]string{1: addrs[1]})
+	if err != nil {
+		t.Fatalf("NewTCPTransport(1): %v", err)
+	}
+	defer t1.Close()
+	t2, err := NewTCPTransport(2, addrs)
+	if err != nil {
+		t.Fatalf("NewTCPTransport(2): %v", err)
+	}
+	defer t2.Close()
+
+	if err := t1.Send(Message{From: 1, To: 2, Type: HeartbeatMsg}); err == nil {
+		t.Fatal("Send to a peer not yet added succeeded")
+	}
+	t1.AddPeer(2, addrs[2])
+	if err := t1.Send(Message{From: 1, To: 2, Type: HeartbeatMsg}); err != nil {
+		t.Fatalf("Send after AddPeer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if got, err := t2.Receive(ctx); err != nil || got.From != 1 {
+		t.Errorf("Receive = (%+v, %v), want the heartbeat from node 1", got, err)
+	}
+}
+
+func TestTCPTransportReconnect(t *testing.T) {
+	addrs := freeAddrs(t, 1, 2)
+	t1, err := NewTCPTransport(1, addrs)
+	if err != nil {
+		t.Fatalf("NewTCPTransport(1): %v", err)
+	}
+	defer t1.Close()
+	t2, err := NewTCPTransport(2, addrs)
+	if err != nil {
+		t.Fatalf("NewTCPTransport(2): %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	t1.Send(Message{From: 1, To: 2, Type: HeartbeatMsg})
+	if _, err := t2.Receive(ctx); err != nil {
+		t.Fatalf("Receive before restart: %v", err)
+	}
+
+	// Restart peer 2 on the same address.
+	t2.Close()
+	t2, err = NewTCPTransport(2, addrs)
+	if err != nil {
+		t.Fatalf("restart NewTCPTransport(2): %v", err)
+	}
+	defer t2.Close()
+
+	// Messages written into the dead connection are lost, so keep sending
+	// until one arrives over the re-dialed connection.
+	received := make(chan Message, 1)
+	go func() {
+		msg, err := t2.Receive(ctx)
+		if err == nil {
+			received <- msg
+		}
+	}()
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		t1.Send(Message{From: 1, To: 2, Type: HeartbeatMsg, Slot: 1})
+		select {
+		case msg := <-received:
+			if msg.Slot != 1 {
+				t.Errorf("slot = %d, want 1", msg.Slot)
+			}
+			return
+		case <-ticker.C:
+		case <-ctx.Done():
+			t.Fatal("no message delivered after peer restart")
+		}
+	}
+}
+
+// unknownTypeFrame encodes a message from one node to another of type 42,
+// correctly framed and checksummed.
+func unknownTypeFrame(from, to int) []byte {
+	payload, _ := MarshalMessage(Message{From: from, To: to, Type: PrepareMsg})
+	payload[1] = 42
+	binary.BigEndian.PutUint32(payload[len(payload)-4:], crc32.ChecksumIEEE(payload[:len(payload)-4]))
+	return payload
+}
+
+func TestTCPTransportSkipsUnknownMessageType(t *testing.T) {
+	addrs := freeAddrs(t, 2)
+	tr, err := NewTCPTransport(2, addrs)
+	if err != nil {
+		t.Fatalf("NewTCPTransport: %v", err)
+	}
+	defer tr.Close()
+
+	// A peer running a newer version sends a type this one does not know,
+	// and then a message it does know.
+	known, _ := MarshalMessage(Message{From: 1, To: 2, Type: PrepareMsg, Slot: 5})
+	conn, err := net.Dial("tcp", addrs[2])
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, unknownTypeFrame(1, 2)); err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+	if err := writeFrame(conn, known); err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tr.Receive(ctx); !errors.Is(err, ErrUnknownMessageType) {
+		t.Fatalf("Receive error = %v, want %v", err, ErrUnknownMessageType)
+	}
+	got, err := tr.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive after the unknown type: %v", err)
+	}
+	if got.Type != PrepareMsg || got.Slot != 5 {
+		t.Errorf("received %+v, want the prepare for slot 5", got)
+	}
+}
+
+func TestTCPTransportClose(t *testing.T) {
+	addrs := freeAddrs(t, 1, 2)
+	tr, err := NewTCPTransport(1, addrs)
+	if err != nil {
+		t.Fatalf("NewTCPTransport: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := tr.Receive(context.Background())
+		errCh <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := tr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if err != ErrTransportClosed {
+			t.Errorf("Receive after Close: got %v, want %v", err, ErrTransportClosed)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Receive did not return after Close")
+	}
+	if err := tr.Send(Message{From: 1, To: 2}); err != ErrTransportClosed {
+		t.Errorf("Send after Close: got %v, want %v", err, ErrTransportClosed)
+	}
+}
+
+func TestNodeOverTCP(t *testing.T) {
+	ids := []int{1, 2, 3}
+	addrs := freeAddrs(t, ids...)
+
+	nodes := make(map[int]*Node)
+	for _, id := range ids {
+		tr, err := NewTCPTransport(id, addrs)
+		if err != nil {
+			t.Fatalf("NewTCPTransport(%d): %v", id, err)
+		}
+		defer tr.Close()
+		var peerIDs []int
+		for _, pid := range ids {
+			if pid != id {
+				peerIDs = append(peerIDs, pid)
+			}
+		}
+		nodes[id] = NewNode(id, peerIDs, tr)
+	}
+
+	ctx := context.Background()
+	for _, node := range nodes {
+		node.Start(ctx)
+	}
+	defer func() {
+		for _, node := range nodes {
+			node.Stop()
+		}
+	}()
+
+	waitForLeader(t, nodes, 3)
+
+	if err := nodes[3].Propose(ctx, []byte("over-tcp")); err != nil {
+		t.Fatalf("Propose failed: %v", err)
+	}
+
+	for _, id := range ids {
+		select {
+		case entry := <-nodes[id].Committed():
+			if string(entry.Value) != "over-tcp" {
+				t.Errorf("node %d: value = %q, want %q", id, entry.Value, "over-tcp")
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("node %d: timed out waiting for committed entry", id)
+		}
+	}
+}
+
+func TestNodeReportsUndecodableMessages(t *testing.T) {
+	addrs := freeAddrs(t, 1)
+	tr, err := NewTCPTransport(1, addrs)
+	if err != nil {
+		t.Fatalf("NewTCPTransport: %v", err)
+	}
+	node := NewNode(1, nil, tr)
+	node.Start(context.Background())
+	defer node.Stop()
+	defer tr.Close()
+
+	conn, err := net.Dial("tcp", addrs[1])
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, unknownTypeFrame(2, 1)); err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+	select {
+	case err := <-node.Errors():
+		if !errors.Is(err, ErrUnknownMessageType) {
+			t.Errorf("error = %v, want %v", err, ErrUnknownMessageType)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no error reported for a frame of type 42")
+	}
+	if got := node.Rejected(); got != 1 {
+		t.Errorf("Rejected() = %d, want 1", got)
+	}
+}
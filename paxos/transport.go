@@ -11,25 +11,47 @@ const (
 	AcceptMsg
 	AckMsg
 	HeartbeatMsg
+	NackMsg
+	AcceptedMsg
+	CatchupRequestMsg
+	CatchupReplyMsg
+	SnapshotMsg
 )
 
+// valid reports whether t is a message type this package understands.
+func (t MessageType) valid() bool {
+	return t >= PrepareMsg && t <= SnapshotMsg
+}
+
 // Message is the public, transport-level representation of a Paxos message.
 type Message struct {
 	From   int
 	To     int
 	Type   MessageType
-	Number int
+	Ballot Ballot
 	Value  []byte
 	Slot   int
+
+	// Promised is set on Ack messages to the prepare ballot being promised.
+	// Ballot then holds the previously accepted ballot, if any.
+	Promised Ballot
+	// HighestAccepted is set on Ack messages to the highest slot the
+	// acceptor has accepted a value in, or -1 if there is none.
+	HighestAccepted int
 }
 
 // Entry represents a decided value for a given slot.
 type Entry struct {
-	Slot  int
+	Slot int
+	// Index is the value's position within its slot when the slot holds a
+	// batch of values, and zero otherwise.
+	Index int
 	Value []byte
 }
 
 // Transport is the pluggable networking interface for Paxos nodes.
+// Receive may return an error wrapping one of the codec errors for a message
+// that arrived but could not be decoded; the transport is still usable.
 type Transport interface {
 	Send(msg Message) error
 	Receive(ctx context.Context) (Message, error)
@@ -40,9 +62,12 @@ func toPublicMessage(m messageData) Message {
 		From:   m.messageSender,
 		To:     m.messageRecipient,
 		Type:   MessageType(m.messageCategory),
-		Number: m.messageNumber,
+		Ballot: m.ballot,
 		Value:  []byte(m.value),
 		Slot:   m.slot,
+
+		Promised:        m.promised,
+		HighestAccepted: m.highestAccepted,
 	}
 }
 
@@ -51,8 +76,10 @@ func toInternalMessage(m Message) messageData {
 		messageSender:    m.From,
 		messageRecipient: m.To,
 		messageCategory:  messageType(m.Type),
-		messageNumber:    m.Number,
+		ballot:           m.Ballot,
 		value:            string(m.Value),
 		slot:             m.Slot,
+		promised:         m.Promised,
+		highestAccepted:  m.HighestAccepted,
 	}
 }
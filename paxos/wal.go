@@ -0,0 +1,263 @@
+package paxos
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WAL is a file-backed Storage built on a write-ahead log. Each promise,
+// accept and decision is appended as a framed, checksummed record and fsynced
+// before the call returns, so a restarted acceptor never forgets what it told
+// others. Reads are served from an in-memory copy rebuilt when the log is opened.
+// Saving a snapshot rewrites the log without the slots it covers.
+type WAL struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64 // offset just past the last complete record
+
+	state *MemoryStorage
+}
+
+// walMaxRecordSize bounds the encoding of a log record: the largest value
+// the codec takes, plus room for the fields around it. Larger records are
+// refused when written, as replay could not read them back.
+const walMaxRecordSize = maxValueSize + 1<<10
+
+// OpenWAL opens or creates the log at path and replays its records. A final
+// record torn by a crash in the middle of a write is discarded. A bad record
+// with more of the log after it is corruption rather than a torn write, and
+// OpenWAL fails instead of throwing away the records that follow.
+func OpenWAL(path string) (*WAL, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("wal: open %s: %w", path, err)
+	}
+	w := &WAL{
+		path:  path,
+		file:  file,
+		state: NewMemoryStorage(),
+	}
+	if err := w.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *WAL) replay() error {
+	reader := bufio.NewReader(w.file)
+	var offset int64
+	for {
+		frame, err := readFrame(reader, walMaxRecordSize)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return fmt.Errorf("wal: %s: record at offset %d: %w", w.path, offset, err)
+		}
+		msg, err := UnmarshalMessage(frame)
+		if err != nil {
+			// A write cut short can leave a whole frame of garbage, but
+			// only at the end of the log.
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				break
+			}
+			return fmt.Errorf("wal: %s: record at offset %d: %w", w.path, offset, err)
+		}
+		switch msg.Type {
+		case PrepareMsg:
+			w.state.SetPromised(msg.Slot, msg)
+		case ProposeMsg:
+			w.state.SetAccepted(msg.Slot, msg)
+		case AcceptMsg:
+			w.state.SetDecided(msg.Slot, msg.Value)
+		case SnapshotMsg:
+			w.state.SetSnapshot(Snapshot{Slot: msg.Slot, Data: msg.Value})
+		}
+		offset += int64(4 + len(frame))
+	}
+	return w.truncate(offset)
+}
+
+// truncate drops everything after the last complete record and positions
+// the file for appending.
+func (w *WAL) truncate(offset int64) error {
+	if err := w.file.Truncate(offset); err != nil {
+		return fmt.Errorf("wal: truncate: %w", err)
+	}
+	if _, err := w.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("wal: seek: %w", err)
+	}
+	w.size = offset
+	return nil
+}
+
+func (w *WAL) Promised(slot int) (Message, bool) {
+	return w.state.Promised(slot)
+}
+
+func (w *WAL) SetPromised(slot int, msg Message) error {
+	msg.Type, msg.Slot = PrepareMsg, slot
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.append(msg); err != nil {
+		return err
+	}
+	return w.state.SetPromised(slot, msg)
+}
+
+func (w *WAL) Accepted(slot int) (Message, bool) {
+	return w.state.Accepted(slot)
+}
+
+func (w *WAL) SetAccepted(slot int, msg Message) error {
+	msg.Type, msg.Slot = ProposeMsg, slot
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.append(msg); err != nil {
+		return err
+	}
+	return w.state.SetAccepted(slot, msg)
+}
+
+func (w *WAL) HighestAccepted() int {
+	return w.state.HighestAccepted()
+}
+
+func (w *WAL) Decided(slot int) ([]byte, bool) {
+	return w.state.Decided(slot)
+}
+
+func (w *WAL) SetDecided(slot int, value []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.append(Message{Type: AcceptMsg, Slot: slot, Value: value}); err != nil {
+		return err
+	}
+	return w.state.SetDecided(slot, value)
+}
+
+func (w *WAL) Snapshot() (Snapshot, bool) {
+	return w.state.Snapshot()
+}
+
+func (w *WAL) SetSnapshot(snap Snapshot) error {
+	if len(snap.Data) > maxValueSize {
+		return fmt.Errorf("wal: snapshot of %d bytes exceeds %d", len(snap.Data), maxValueSize)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if current, ok := w.state.Snapshot(); ok && snap.Slot <= current.Slot {
+		return nil
+	}
+	// The snapshot goes into the current log first, so that it survives
+	// even if the rewrite below does not.
+	if err := w.append(Message{Type: SnapshotMsg, Slot: snap.Slot, Value: snap.Data}); err != nil {
+		return err
+	}
+	w.state.SetSnapshot(snap)
+	return w.compact()
+}
+
+// compact rewrites the log as just the records that rebuild the current
+// state, then swaps it in for the old log. Should the rewrite fail, the old
+// log stays in place; it already holds the snapshot, and only holds more
+// than it needs to. Callers hold w.mu.
+func (w *WAL) compact() error {
+	tmpPath := w.path + ".compact"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("wal: compact: %w", err)
+	}
+	fail := func(err error) error {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("wal: compact: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	var size int64
+	for _, msg := range w.state.records() {
+		frame, err := encodeRecord(msg)
+		if err != nil {
+			return fail(err)
+		}
+		if _, err := writer.Write(frame); err != nil {
+			return fail(err)
+		}
+		size += int64(len(frame))
+	}
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := file.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		return fail(err)
+	}
+	// The rename is only durable once the directory is synced. The new log
+	// is at w.path whether or not that works, so later appends go to it.
+	err = syncDir(filepath.Dir(w.path))
+	w.file.Close()
+	w.file, w.size = file, size
+	if err != nil {
+		return fmt.Errorf("wal: compact: %w", err)
+	}
+	return nil
+}
+
+// syncDir fsyncs the directory at path, making renames within it durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// encodeRecord frames msg as a log record: its length, then its encoding.
+func encodeRecord(msg Message) ([]byte, error) {
+	payload, err := MarshalMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > walMaxRecordSize {
+		return nil, fmt.Errorf("wal: record of %d bytes exceeds %d", len(payload), walMaxRecordSize)
+	}
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(payload)), uint32(len(payload)))
+	return append(frame, payload...), nil
+}
+
+// append writes msg to the end of the log. Callers hold w.mu.
+func (w *WAL) append(msg Message) error {
+	frame, err := encodeRecord(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Write(frame); err != nil {
+		// Drop the partial record so later appends stay readable.
+		w.truncate(w.size)
+		return fmt.Errorf("wal: write: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		w.truncate(w.size)
+		return fmt.Errorf("wal: sync: %w", err)
+	}
+	w.size += int64(len(frame))
+	return nil
+}
+
+// Close closes the underlying file.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
@@ -0,0 +1,243 @@
+package paxos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newDurableTestAcceptor(t *testing.T, path string) (*Acceptor, *WAL) {
+	t.Helper()
+	w, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	a, _ := newTestAcceptor(1)
+	a.SetStorage(w)
+	return a, w
+}
+
+func TestWALRecoversAcceptorState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acceptor.wal")
+
+	a, w := newDurableTestAcceptor(t, path)
+	a.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{1, 100}, messageCategory: PrepareMessage, value: "first", slot: 0,
+	})
+	a.receiveProposeMessage(messageData{
+		messageSender: 100, ballot: Ballot{1, 100}, messageCategory: ProposeMessage, value: "first", slot: 0,
+	})
+	a.receivePreparedMessage(messageData{
+		messageSender: 101, ballot: Ballot{2, 101}, messageCategory: PrepareMessage, value: "second", slot: 3,
+	})
+	w.Close()
+
+	// Simulate a restart.
+	restarted, w2 := newDurableTestAcceptor(t, path)
+	defer w2.Close()
+
+	if got := restarted.accepted(0); got.getBallot() != (Ballot{1, 100}) || got.value != "first" {
+		t.Errorf("slot 0 accepted = (%v, %q), want (1.100, %q)", got.getBallot(), got.value, "first")
+	}
+	if got := restarted.promised(3).getBallot(); got != (Ballot{2, 101}) {
+		t.Errorf("slot 3 promised = %v, want 2.101", got)
+	}
+
+	// The restarted acceptor must still honour its promise.
+	if ack := restarted.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{1, 100}, messageCategory: PrepareMessage, slot: 3,
+	}); ack != nil {
+		t.Error("restarted acceptor accepted a prepare lower than its recovered promise")
+	}
+	// And it must report its previously accepted value.
+	ack := restarted.receivePreparedMessage(messageData{
+		messageSender: 101, ballot: Ballot{3, 101}, messageCategory: PrepareMessage, value: "third", slot: 0,
+	})
+	if ack == nil || ack.value != "first" {
+		t.Errorf("ack after restart = %+v, want previously accepted value %q", ack, "first")
+	}
+}
+
+func TestWALDiscardsTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acceptor.wal")
+
+	a, w := newDurableTestAcceptor(t, path)
+	a.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{1, 100}, messageCategory: PrepareMessage, slot: 0,
+	})
+	a.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{2, 100}, messageCategory: PrepareMessage, slot: 1,
+	})
+	w.Close()
+
+	// Chop the last record in half, as a crash mid-write would.
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if err := os.Truncate(path, info.Size()-5); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+
+	restarted, w2 := newDurableTestAcceptor(t, path)
+	if got := restarted.promised(0).getBallot(); got != (Ballot{1, 100}) {
+		t.Errorf("slot 0 promised = %v, want 1.100", got)
+	}
+	// The last record written was the global promise for 20100.
+	if got := restarted.promised(globalPromiseSlot).getBallot(); got != (Ballot{1, 100}) {
+		t.Errorf("global promise = %v, want 1.100 after discarding the torn record", got)
+	}
+
+	// New records appended after recovery must survive another restart.
+	restarted.receivePreparedMessage(messageData{
+		messageSender: 100, ballot: Ballot{3, 100}, messageCategory: PrepareMessage, slot: 2,
+	})
+	w2.Close()
+
+	again, w3 := newDurableTestAcceptor(t, path)
+	defer w3.Close()
+	if got := again.promised(2).getBallot(); got != (Ballot{3, 100}) {
+		t.Errorf("slot 2 promised after second restart = %v, want 3.100", got)
+	}
+}
+
+func TestWALRejectsCorruptRecordMidLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	w, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	for slot := 0; slot < 3; slot++ {
+		w.SetDecided(slot, []byte("some value"))
+	}
+	w.Close()
+
+	// Damage the first record; the two after it are intact.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	data[6] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if w, err := OpenWAL(path); err == nil {
+		w.Close()
+		t.Fatal("OpenWAL accepted a log with a corrupt record before intact ones")
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != int64(len(data)) {
+		t.Errorf("log was truncated after a failed open")
+	}
+}
+
+func TestWALRecordSizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acceptor.wal")
+	w, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	if err := w.SetAccepted(0, Message{Type: ProposeMsg, Ballot: Ballot{1, 1}, Value: make([]byte, maxValueSize)}); err != nil {
+		t.Fatalf("SetAccepted with a value of maxValueSize: %v", err)
+	}
+	if err := w.SetAccepted(1, Message{Type: ProposeMsg, Ballot: Ballot{1, 1}, Value: make([]byte, maxValueSize+1)}); err == nil {
+		t.Error("SetAccepted with a value over maxValueSize succeeded")
+	}
+	if err := w.SetDecided(2, []byte("after")); err != nil {
+		t.Fatalf("SetDecided: %v", err)
+	}
+	w.Close()
+
+	// Every record written must be read back.
+	w, err = OpenWAL(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer w.Close()
+	if msg, ok := w.Accepted(0); !ok || len(msg.Value) != maxValueSize {
+		t.Errorf("slot 0 accepted %d bytes, want %d", len(msg.Value), maxValueSize)
+	}
+	if _, ok := w.Accepted(1); ok {
+		t.Error("slot 1 holds the value that was refused")
+	}
+	if value, ok := w.Decided(2); !ok || string(value) != "after" {
+		t.Errorf("slot 2 decided = %q, %v; want %q", value, ok, "after")
+	}
+}
+
+func TestWALSnapshotRewritesLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	w, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	for slot := 0; slot < 50; slot++ {
+		w.SetAccepted(slot, Message{Ballot: Ballot{1, 100}, Value: []byte("some value")})
+		w.SetDecided(slot, []byte("some value"))
+	}
+	before, _ := os.Stat(path)
+	if err := w.SetSnapshot(Snapshot{Slot: 47, Data: []byte("state")}); err != nil {
+		t.Fatalf("SetSnapshot: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("log is %d bytes after compaction, was %d", after.Size(), before.Size())
+	}
+	// Records appended after compaction land in the new log.
+	w.SetDecided(50, []byte("later"))
+	w.Close()
+
+	w, err = OpenWAL(path)
+	if err != nil {
+		t.Fatalf("reopen OpenWAL: %v", err)
+	}
+	defer w.Close()
+	if snap, ok := w.Snapshot(); !ok || snap.Slot != 47 || string(snap.Data) != "state" {
+		t.Errorf("snapshot after reopen = (%+v, %v), want slot 47", snap, ok)
+	}
+	if _, ok := w.Decided(47); ok {
+		t.Error("slot 47 is covered by the snapshot but survived reopen")
+	}
+	for _, slot := range []int{48, 49, 50} {
+		if _, ok := w.Decided(slot); !ok {
+			t.Errorf("slot %d was lost by compaction", slot)
+		}
+	}
+	if _, ok := w.Accepted(48); !ok {
+		t.Error("accepted state for slot 48 was lost by compaction")
+	}
+}
+
+func TestWALKeepsSnapshotWhenRewriteFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	w, err := OpenWAL(path)
+	if err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	for slot := 0; slot < 5; slot++ {
+		w.SetDecided(slot, []byte("some value"))
+	}
+	// A directory in the way of the rewritten log makes compaction fail.
+	if err := os.Mkdir(path+".compact", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetSnapshot(Snapshot{Slot: 3, Data: []byte("state")}); err == nil {
+		t.Fatal("SetSnapshot succeeded with the rewrite blocked")
+	}
+	w.SetDecided(5, []byte("later"))
+	w.Close()
+
+	w, err = OpenWAL(path)
+	if err != nil {
+		t.Fatalf("reopen OpenWAL: %v", err)
+	}
+	defer w.Close()
+	if snap, ok := w.Snapshot(); !ok || snap.Slot != 3 || string(snap.Data) != "state" {
+		t.Errorf("snapshot after reopen = (%+v, %v), want slot 3", snap, ok)
+	}
+	for _, slot := range []int{4, 5} {
+		if _, ok := w.Decided(slot); !ok {
+			t.Errorf("slot %d was lost", slot)
+		}
+	}
+}